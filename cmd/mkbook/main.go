@@ -0,0 +1,83 @@
+// Command mkbook builds an opening book from game collections.
+//
+// Usage:
+//
+//	mkbook [-o book.bin] [-maxply n] [-minfreq n] [-stats] file...
+//
+// Files ending in .pgn are read as PGN with moves in coordinate notation;
+// any other file is read as a UCCI session log, taking its games from the
+// "position ... moves ..." commands. The games of all files are merged into
+// one book. Problems with single games are reported and the rest are used.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hmgle/godogpaw/engine"
+)
+
+func main() {
+	out := flag.String("o", "book.bin", "output book file")
+	maxPly := flag.Int("maxply", 30, "only use the first plies of each game, 0 for all")
+	minFreq := flag.Int("minfreq", 1, "leave out moves played in fewer games")
+	stats := flag.Bool("stats", false, "print the win/draw/loss counts of every move")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: mkbook [flags] file...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	b := engine.NewBookBuilder(*maxPly, *minFreq)
+	for _, path := range flag.Args() {
+		games, err := addFile(b, path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "mkbook: %s: %v\n", path, err)
+		}
+		fmt.Fprintf(os.Stderr, "%s: %d games\n", path, games)
+	}
+
+	if *stats {
+		for _, st := range b.Stats() {
+			fmt.Printf("%016x %s games %d +%d =%d -%d\n",
+				st.Key, engine.Move2Str(st.Move), st.Games, st.Wins, st.Draws, st.Losses)
+		}
+	}
+
+	book := b.Book()
+	f, err := os.Create(*out)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mkbook: %v\n", err)
+		os.Exit(1)
+	}
+	if err := book.Write(f); err != nil {
+		f.Close()
+		fmt.Fprintf(os.Stderr, "mkbook: write %s: %v\n", *out, err)
+		os.Exit(1)
+	}
+	if err := f.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "mkbook: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "%s: %d moves\n", *out, len(book.Entries()))
+}
+
+// addFile adds the games of one input file to b.
+func addFile(b *engine.BookBuilder, path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if strings.EqualFold(filepath.Ext(path), ".pgn") {
+		return b.ReadPGN(f)
+	}
+	return b.ReadPositionLog(f)
+}
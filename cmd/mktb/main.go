@@ -0,0 +1,61 @@
+// Command mktb generates endgame tablebases.
+//
+// Usage:
+//
+//	mktb [-dir tb] material...
+//
+// Each material names the pieces of both sides after their kings, such as
+// KRKAA for rook against two advisors or KNKP for knight against pawn. The
+// tables it leads to by captures are generated too; those already in the
+// directory are reused. Tables are limited to engine.MaxTablebaseSize
+// positions per side: two rooks, knights, cannons or pawns with up to two
+// advisors and bishops, as in KRKNA or KRKCAB, or one of them with up to
+// four, as in KRKAABB.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/hmgle/godogpaw/engine"
+)
+
+func main() {
+	dir := flag.String("dir", "tb", "tablebase directory")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: mktb [flags] material...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		fmt.Fprintf(os.Stderr, "mktb: %v\n", err)
+		os.Exit(1)
+	}
+	tbs, err := engine.LoadTablebases(*dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mktb: %v\n", err)
+		os.Exit(1)
+	}
+	for _, name := range flag.Args() {
+		start := time.Now()
+		made, err := tbs.Generate(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "mktb: %s: %v\n", name, err)
+			os.Exit(1)
+		}
+		for _, t := range made {
+			if err := t.Save(*dir); err != nil {
+				fmt.Fprintf(os.Stderr, "mktb: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Fprintf(os.Stderr, "%s%s written\n", t.Name(), engine.TablebaseExt)
+		}
+		fmt.Fprintf(os.Stderr, "%s: %d tables in %v\n", name, len(made), time.Since(start).Round(time.Millisecond))
+	}
+}
@@ -0,0 +1,47 @@
+package engine
+
+import "time"
+
+// benchPositions are searched by Bench: the start position, positions from
+// common openings and a few endgames.
+var benchPositions = []string{
+	StartFEN,
+	"r1bakabr1/9/2n3n2/p1p1p1p1p/9/2P6/Pc2P1PcP/1CN1C1N2/9/R1BAKABR1 w - - 10 6",
+	"1rbakab1r/9/2n3nc1/p1p1p3p/6p2/2P6/Pc2P1P1P/C1N3NC1/9/1RBAKAB1R w - - 10 6",
+	"1rbakabr1/9/1cn1c1n2/pC2p1p1p/2p6/9/P1P1P1P1P/2N1C1N2/9/1RBAKABR1 w - - 12 7",
+	"2bakab1r/3r5/1cn3n2/pC2p1p1p/2p6/2P3P2/P3P2cP/2N3NC1/9/1RBAKAB1R w - - 12 7",
+	"r1bakabr1/9/1cn3n2/p1p1C3p/9/5Np2/P1P1P2cP/1C7/9/RNBAKABR1 w - - 1 7",
+	"1rbakab2/8r/c1n3nc1/p1p1p3p/6p2/4P4/P1P3P1P/2N1C1NC1/9/1RBAKABR1 w - - 12 7",
+	"1rbakab2/7r1/2n1c1nc1/p1p1p1p1p/9/9/P1P1P1P1P/1CN1C1N2/5R3/1RBAKAB2 w - - 12 7",
+	"4ka3/4a4/4b4/9/9/2P6/9/9/4K4/5R3 w - - 0 1",
+	"3k5/4P4/9/9/2n6/9/9/3C5/4A4/4K4 w - - 0 1",
+	"2bak4/4a4/4b4/9/2p6/9/3N5/4B4/4A4/3AK1B2 w - - 0 1",
+}
+
+// BenchPosition is the outcome of searching one bench position.
+type BenchPosition struct {
+	FEN   string
+	Nodes int
+	Time  time.Duration // time to reach the bench depth
+}
+
+// Bench searches every bench position to depth on one thread, starting
+// each from an empty hash table of hashMB megabytes. The total node count
+// is a signature of the search: it changes only when the search does.
+func Bench(depth uint8, hashMB int) []BenchPosition {
+	s := NewSearcher()
+	s.SetHashSize(hashMB)
+	s.SetReporter(nil)
+	res := make([]BenchPosition, 0, len(benchPositions))
+	for _, fen := range benchPositions {
+		var pos PositionNG
+		if err := pos.Set(fen); err != nil {
+			panic(err)
+		}
+		s.ClearHash()
+		start := time.Now()
+		r := s.Search(&pos, SearchLimits{Depth: depth})
+		res = append(res, BenchPosition{FEN: fen, Nodes: r.Nodes, Time: time.Since(start)})
+	}
+	return res
+}
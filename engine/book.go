@@ -0,0 +1,207 @@
+package engine
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"slices"
+)
+
+// An opening book file is laid out like a Polyglot book, with a header in
+// front because the keys are this engine's Zobrist keys. All numbers are
+// big endian, keeping the entry layout of Polyglot byte for byte, while the
+// engine's own hash and tablebase files are little endian:
+//
+//	magic   [8]byte  "GDPBOOK\x00"
+//	version uint32   bookVersion
+//	_       uint32   reserved, 0
+//	sideKey uint64   Zobrist key of the side to move, to catch generator changes
+//
+// followed by 16-byte entries sorted by key, then by weight, highest first:
+//
+//	key    uint64   PositionNG.Key of the position
+//	move   uint16   the move, as MoveNG: origin << 7 | destination
+//	weight uint16   relative frequency or quality of the move
+//	learn  uint32   free for learning data; kept but not used by the engine
+const bookVersion = 1
+
+var bookMagic = [8]byte{'G', 'D', 'P', 'B', 'O', 'O', 'K', 0}
+
+type bookHeader struct {
+	Magic    [8]byte
+	Version  uint32
+	Reserved uint32
+	SideKey  uint64
+}
+
+// BookEntry is one move of the opening book.
+type BookEntry struct {
+	Key    Key
+	Move   MoveNG
+	Weight uint16
+	Learn  uint32
+}
+
+type bookRecord struct {
+	Key    uint64
+	Move   uint16
+	Weight uint16
+	Learn  uint32
+}
+
+// Book is an opening book held in memory.
+type Book struct {
+	entries []BookEntry
+}
+
+// BookMode selects how a move is picked among the book moves of a position.
+type BookMode int
+
+const (
+	// BookWeighted picks a move at random with probability proportional
+	// to its weight.
+	BookWeighted BookMode = iota
+	// BookBest always picks the move with the highest weight.
+	BookBest
+)
+
+// ErrBookFile reports a file that is not a book for this engine.
+var ErrBookFile = errors.New("incompatible book file")
+
+// NewBook returns a book of the given entries.
+func NewBook(entries []BookEntry) *Book {
+	b := &Book{entries: slices.Clone(entries)}
+	slices.SortStableFunc(b.entries, compareBookEntries)
+	return b
+}
+
+// compareBookEntries orders entries by key, and the moves of a key by
+// descending weight.
+func compareBookEntries(x, y BookEntry) int {
+	if c := cmp.Compare(x.Key, y.Key); c != 0 {
+		return c
+	}
+	return cmp.Compare(y.Weight, x.Weight)
+}
+
+// Entries returns all entries of the book, sorted by key.
+func (b *Book) Entries() []BookEntry {
+	return b.entries
+}
+
+// ReadBook reads a book written by Book.Write. The entries must be sorted
+// by key; the moves of a key are put highest weight first whatever their
+// order in the file.
+func ReadBook(r io.Reader) (*Book, error) {
+	br := bufio.NewReader(r)
+	var hdr bookHeader
+	if err := binary.Read(br, binary.BigEndian, &hdr); err != nil {
+		return nil, fmt.Errorf("read book header: %w", err)
+	}
+	switch {
+	case hdr.Magic != bookMagic:
+		return nil, fmt.Errorf("%w: not a book", ErrBookFile)
+	case hdr.Version != bookVersion:
+		return nil, fmt.Errorf("%w: version %d, want %d", ErrBookFile, hdr.Version, bookVersion)
+	case hdr.SideKey != zkey.side:
+		return nil, fmt.Errorf("%w: made with other Zobrist keys", ErrBookFile)
+	}
+	b := &Book{}
+	for {
+		var rec bookRecord
+		err := binary.Read(br, binary.BigEndian, &rec)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read book entry %d: %w", len(b.entries), err)
+		}
+		b.entries = append(b.entries, BookEntry{
+			Key:    rec.Key,
+			Move:   MoveNG(rec.Move),
+			Weight: rec.Weight,
+			Learn:  rec.Learn,
+		})
+	}
+	if !slices.IsSortedFunc(b.entries, func(x, y BookEntry) int { return cmp.Compare(x.Key, y.Key) }) {
+		return nil, fmt.Errorf("%w: entries not sorted by key", ErrBookFile)
+	}
+	slices.SortStableFunc(b.entries, compareBookEntries)
+	return b, nil
+}
+
+// OpenBook loads the book in the named file.
+func OpenBook(path string) (*Book, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadBook(f)
+}
+
+// Write writes the book in the format read by ReadBook.
+func (b *Book) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	hdr := bookHeader{Magic: bookMagic, Version: bookVersion, SideKey: zkey.side}
+	if err := binary.Write(bw, binary.BigEndian, &hdr); err != nil {
+		return err
+	}
+	for _, e := range b.entries {
+		rec := bookRecord{Key: e.Key, Move: uint16(e.Move), Weight: e.Weight, Learn: e.Learn}
+		if err := binary.Write(bw, binary.BigEndian, &rec); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// Moves returns the book entries of pos whose moves are legal there,
+// highest weight first.
+func (b *Book) Moves(pos *PositionNG) []BookEntry {
+	key := pos.Key()
+	i, _ := slices.BinarySearchFunc(b.entries, key, func(e BookEntry, k Key) int {
+		return cmp.Compare(e.Key, k)
+	})
+	var list [MAX_MOVES]MoveNG
+	legal := list[:pos.GenerateLEGAL(list[:])]
+	var moves []BookEntry
+	for ; i < len(b.entries) && b.entries[i].Key == key; i++ {
+		if slices.Contains(legal, b.entries[i].Move) {
+			moves = append(moves, b.entries[i])
+		}
+	}
+	return moves
+}
+
+// Pick chooses a book move for pos among those accepted by allowed, which
+// may be nil. It returns MOVE_NONE if there is none.
+func (b *Book) Pick(pos *PositionNG, mode BookMode, rnd *rand.Rand, allowed func(MoveNG) bool) MoveNG {
+	var moves []BookEntry
+	total := 0
+	for _, e := range b.Moves(pos) {
+		if e.Weight > 0 && (allowed == nil || allowed(e.Move)) {
+			moves = append(moves, e)
+			total += int(e.Weight)
+		}
+	}
+	if len(moves) == 0 {
+		return MOVE_NONE
+	}
+	if mode == BookBest {
+		return moves[0].Move
+	}
+	n := rnd.Intn(total)
+	for _, e := range moves {
+		if n < int(e.Weight) {
+			return e.Move
+		}
+		n -= int(e.Weight)
+	}
+	return moves[len(moves)-1].Move
+}
@@ -0,0 +1,214 @@
+package engine
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+const afterCentralCannon = "rnbakabnr/9/1c5c1/p1p1p1p1p/9/9/P1P1P1P1P/1C2C4/9/RNBAKABNR b - - 1 1"
+
+func mustSquare(t *testing.T, s string) Square {
+	t.Helper()
+	sq, err := SquareFromString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sq
+}
+
+func mustPosition(t *testing.T, fen string) *PositionNG {
+	t.Helper()
+	var pos PositionNG
+	if err := pos.Set(fen); err != nil {
+		t.Fatal(err)
+	}
+	return &pos
+}
+
+// fixtureBook is the content of testdata/small.book: three moves of the
+// start position plus an illegal one, and two replies to the central
+// cannon, one of them with no weight.
+func fixtureBook(t *testing.T) *Book {
+	entry := func(fen, move string, weight uint16) BookEntry {
+		return BookEntry{
+			Key:    mustPosition(t, fen).Key(),
+			Move:   MakeMove(mustSquare(t, move[:2]), mustSquare(t, move[2:])),
+			Weight: weight,
+		}
+	}
+	return NewBook([]BookEntry{
+		entry(initialFen, "c3c4", 10),
+		entry(initialFen, "h2e2", 60),
+		entry(initialFen, "e0e2", 90), // illegal king move
+		entry(initialFen, "b2e2", 30),
+		entry(afterCentralCannon, "h9g7", 40),
+		entry(afterCentralCannon, "b7e7", 0),
+	})
+}
+
+func moveNames(entries []BookEntry) []string {
+	var names []string
+	for _, e := range entries {
+		names = append(names, Move2Str(e.Move))
+	}
+	return names
+}
+
+func TestBookFixtureFormat(t *testing.T) {
+	want, err := os.ReadFile(filepath.Join("testdata", "small.book"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got bytes.Buffer
+	if err := fixtureBook(t).Write(&got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Errorf("encoded book differs from testdata/small.book:\n got %x\nwant %x", got.Bytes(), want)
+	}
+}
+
+func TestBookMoves(t *testing.T) {
+	book, err := OpenBook(filepath.Join("testdata", "small.book"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(book.Entries()); n != 6 {
+		t.Fatalf("loaded %d entries, want 6", n)
+	}
+	got := moveNames(book.Moves(mustPosition(t, initialFen)))
+	want := []string{"h2e2", "b2e2", "c3c4"}
+	if len(got) != len(want) {
+		t.Fatalf("start position book moves %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("start position book moves %v, want %v", got, want)
+		}
+	}
+	if moves := book.Moves(mustPosition(t, "3k5/9/9/9/9/9/9/9/9/4K4 w - - 0 1")); len(moves) != 0 {
+		t.Errorf("position out of book has moves %v", moveNames(moves))
+	}
+}
+
+func TestBookPick(t *testing.T) {
+	book := fixtureBook(t)
+	start := mustPosition(t, initialFen)
+	rnd := rand.New(rand.NewSource(1))
+
+	if m := book.Pick(start, BookBest, rnd, nil); Move2Str(m) != "h2e2" {
+		t.Errorf("best move %v, want h2e2", m)
+	}
+	counts := map[string]int{}
+	for range 10000 {
+		counts[Move2Str(book.Pick(start, BookWeighted, rnd, nil))]++
+	}
+	for move, weight := range map[string]int{"h2e2": 60, "b2e2": 30, "c3c4": 10} {
+		if got := counts[move]; got < weight*100-300 || got > weight*100+300 {
+			t.Errorf("%s picked %d times out of 10000, want about %d", move, got, weight*100)
+		}
+	}
+	if len(counts) != 3 {
+		t.Errorf("picked moves %v", counts)
+	}
+
+	notCannon := func(m MoveNG) bool { return Move2Str(m) != "h2e2" }
+	if m := book.Pick(start, BookBest, rnd, notCannon); Move2Str(m) != "b2e2" {
+		t.Errorf("best allowed move %v, want b2e2", m)
+	}
+	reply := mustPosition(t, afterCentralCannon)
+	for range 100 {
+		if m := book.Pick(reply, BookWeighted, rnd, nil); Move2Str(m) != "h9g7" {
+			t.Fatalf("picked %v, a move without weight", m)
+		}
+	}
+}
+
+func TestSearcherPlaysBookMoves(t *testing.T) {
+	s := NewSearcher()
+	s.SetHashSize(1)
+	s.SetReporter(nil)
+	s.SetBook(fixtureBook(t), BookBest)
+	start := mustPosition(t, initialFen)
+
+	r := s.Search(start, SearchLimits{Depth: 3})
+	if Move2Str(r.BestMove) != "h2e2" || r.Nodes != 0 {
+		t.Errorf("got %v after %d nodes, want book move h2e2 without searching", r.BestMove, r.Nodes)
+	}
+	r = <-s.Start(start, SearchLimits{Depth: 3, BanMoves: []MoveNG{r.BestMove}})
+	if Move2Str(r.BestMove) != "b2e2" {
+		t.Errorf("with h2e2 banned got %v, want b2e2", r.BestMove)
+	}
+	if r := s.Search(start, SearchLimits{Depth: 3, MultiPV: 2}); r.Nodes == 0 {
+		t.Error("MultiPV analysis played from the book")
+	}
+	s.SetBook(nil, BookBest)
+	if r := s.Search(start, SearchLimits{Depth: 3}); r.Nodes == 0 {
+		t.Error("searcher without book did not search")
+	}
+}
+
+// A book from another tool may list the moves of a position in any order;
+// the best move is still the heaviest one.
+func TestReadBookSortsMovesByWeight(t *testing.T) {
+	entries := slices.Clone(fixtureBook(t).Entries())
+	slices.SortStableFunc(entries, func(x, y BookEntry) int {
+		if c := cmp.Compare(x.Key, y.Key); c != 0 {
+			return c
+		}
+		return cmp.Compare(x.Weight, y.Weight)
+	})
+	var saved bytes.Buffer
+	if err := (&Book{entries: entries}).Write(&saved); err != nil {
+		t.Fatal(err)
+	}
+	book, err := ReadBook(&saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := mustPosition(t, initialFen)
+	if m := book.Pick(start, BookBest, nil, nil); Move2Str(m) != "h2e2" {
+		t.Errorf("best move %v, want h2e2", m)
+	}
+	if got, want := moveNames(book.Moves(start)), []string{"h2e2", "b2e2", "c3c4"}; !slices.Equal(got, want) {
+		t.Errorf("start position book moves %v, want %v", got, want)
+	}
+}
+
+func TestReadBookRejectsIncompatibleFiles(t *testing.T) {
+	var saved bytes.Buffer
+	if err := fixtureBook(t).Write(&saved); err != nil {
+		t.Fatal(err)
+	}
+	patch := func(off int, b byte) []byte {
+		data := bytes.Clone(saved.Bytes())
+		data[off] ^= b
+		return data
+	}
+	// Swapping the first and the last entry breaks the key order.
+	unsorted := bytes.Clone(saved.Bytes())
+	first := bytes.Clone(unsorted[24:40])
+	copy(unsorted[24:40], unsorted[104:120])
+	copy(unsorted[104:120], first)
+
+	cases := map[string][]byte{
+		"magic":    patch(0, 1),
+		"version":  patch(11, 1),
+		"side key": patch(23, 1),
+		"unsorted": unsorted,
+	}
+	for name, data := range cases {
+		if _, err := ReadBook(bytes.NewReader(data)); !errors.Is(err, ErrBookFile) {
+			t.Errorf("%s: got error %v, want ErrBookFile", name, err)
+		}
+	}
+	if _, err := ReadBook(bytes.NewReader(saved.Bytes()[:30])); err == nil {
+		t.Error("truncated book loaded")
+	}
+}
@@ -0,0 +1,343 @@
+package engine
+
+import (
+	"bufio"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// StartFEN is the initial position of a game.
+const StartFEN = "rnbakabnr/9/1c5c1/p1p1p1p1p/9/9/P1P1P1P1P/1C5C1/9/RNBAKABNR w - - 0 1"
+
+// GameResult is the outcome of a game fed to a BookBuilder.
+type GameResult int
+
+const (
+	ResultUnknown GameResult = iota
+	ResultRedWins
+	ResultBlackWins
+	ResultDraw
+)
+
+// parseResult reads a PGN result token; ok is false for anything else.
+func parseResult(s string) (r GameResult, ok bool) {
+	switch s {
+	case "1-0":
+		return ResultRedWins, true
+	case "0-1":
+		return ResultBlackWins, true
+	case "1/2-1/2":
+		return ResultDraw, true
+	case "*":
+		return ResultUnknown, true
+	}
+	return ResultUnknown, false
+}
+
+// BookMoveStats counts how a move did in the games it was played in, from
+// the point of view of the side that played it. Games with an unknown
+// result count in Games only.
+type BookMoveStats struct {
+	Key    Key
+	Move   MoveNG
+	Games  int
+	Wins   int
+	Draws  int
+	Losses int
+}
+
+// points scores the move like a tournament, in half points: a win is 2, a
+// draw or an unknown result 1.
+func (s BookMoveStats) points() int {
+	return 2*s.Wins + (s.Games - s.Wins - s.Losses)
+}
+
+type bookMoveKey struct {
+	key  Key
+	move MoveNG
+}
+
+// BookBuilder collects move statistics from games and turns them into an
+// opening book. Games from several sources can be added to one builder;
+// transpositions meet in the same entry as moves are keyed by position.
+type BookBuilder struct {
+	// MaxPly ignores moves played after this many plies of a game, 0 for
+	// no limit.
+	MaxPly int
+	// MinGames leaves out moves played in fewer games.
+	MinGames int
+
+	stats map[bookMoveKey]*BookMoveStats
+}
+
+// NewBookBuilder returns an empty builder with the given filters.
+func NewBookBuilder(maxPly, minGames int) *BookBuilder {
+	return &BookBuilder{
+		MaxPly:   maxPly,
+		MinGames: minGames,
+		stats:    make(map[bookMoveKey]*BookMoveStats),
+	}
+}
+
+// AddGame replays the coordinate moves of a game from fen and counts them.
+// At a move that does not parse or is illegal it stops and returns an
+// error; the moves before it are kept.
+func (b *BookBuilder) AddGame(fen string, moves []string, result GameResult) error {
+	var pos PositionNG
+	if err := pos.Set(fen); err != nil {
+		return err
+	}
+	for ply, s := range moves {
+		if b.MaxPly > 0 && ply >= b.MaxPly {
+			break
+		}
+		m, err := ParseUCIMove(&pos, strings.ReplaceAll(s, "-", ""))
+		if err != nil {
+			return fmt.Errorf("ply %d: %w", ply+1, err)
+		}
+		k := bookMoveKey{pos.Key(), m}
+		st := b.stats[k]
+		if st == nil {
+			st = &BookMoveStats{Key: k.key, Move: m}
+			b.stats[k] = st
+		}
+		st.Games++
+		switch {
+		case result == ResultDraw:
+			st.Draws++
+		case result == ResultRedWins && pos.SideToMove == WHITE,
+			result == ResultBlackWins && pos.SideToMove == BLACK:
+			st.Wins++
+		case result != ResultUnknown:
+			st.Losses++
+		}
+		var si StateInfo
+		pos.DoMove(m, &si)
+	}
+	return nil
+}
+
+// Stats returns the moves played in at least MinGames games, sorted by
+// position key and then by points, best first.
+func (b *BookBuilder) Stats() []BookMoveStats {
+	var stats []BookMoveStats
+	for _, st := range b.stats {
+		if st.Games >= b.MinGames {
+			stats = append(stats, *st)
+		}
+	}
+	slices.SortFunc(stats, func(x, y BookMoveStats) int {
+		if c := cmp.Compare(x.Key, y.Key); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(y.points(), x.points()); c != 0 {
+			return c
+		}
+		return cmp.Compare(x.Move, y.Move)
+	})
+	return stats
+}
+
+// Book returns the book of the moves in Stats, weighted by their points.
+// Moves that only lost score nothing and are left out. If the points do
+// not fit the weight field they are all scaled down.
+func (b *BookBuilder) Book() *Book {
+	stats := b.Stats()
+	maxPoints := 0
+	for _, st := range stats {
+		maxPoints = max(maxPoints, st.points())
+	}
+	var entries []BookEntry
+	for _, st := range stats {
+		p := st.points()
+		if p == 0 {
+			continue
+		}
+		w := p
+		if maxPoints > 0xffff {
+			w = max(1, int(int64(p)*0xffff/int64(maxPoints)))
+		}
+		entries = append(entries, BookEntry{Key: st.Key, Move: st.Move, Weight: uint16(w)})
+	}
+	return NewBook(entries)
+}
+
+// ReadPGN adds the games of a PGN file whose moves are in coordinate
+// notation, as "h2e2" or "H2-E2". The FEN and Result tags are honoured; a
+// result token at the end of the moves takes precedence. Comments,
+// variations and move numbers are skipped. It returns the number of games
+// added; games with a bad move are added up to that move and reported in
+// the error, which joins the problems of every game.
+func (b *BookBuilder) ReadPGN(r io.Reader) (int, error) {
+	var (
+		errs    []error
+		games   int
+		fen     = StartFEN
+		result  GameResult
+		moves   []string
+		inGame  bool
+		depth   int // nesting of comments and variations
+		lineNum int
+	)
+	finish := func() {
+		if !inGame {
+			return
+		}
+		games++
+		if err := b.AddGame(fen, moves, result); err != nil {
+			errs = append(errs, fmt.Errorf("game %d ending on line %d: %w", games, lineNum, err))
+		}
+		fen, result, moves, inGame = StartFEN, ResultUnknown, nil, false
+	}
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		lineNum++
+		line := strings.TrimSpace(sc.Text())
+		if depth == 0 && strings.HasPrefix(line, "[") {
+			if len(moves) > 0 {
+				finish()
+			}
+			name, value, ok := parseTag(line)
+			if !ok {
+				continue
+			}
+			inGame = true
+			switch name {
+			case "FEN":
+				fen = value
+			case "Result":
+				result, _ = parseResult(value)
+			}
+			continue
+		}
+	tokens:
+		for _, tok := range pgnTokens(line) {
+			switch {
+			case tok == "{" || tok == "(":
+				depth++
+			case tok == "}" || tok == ")":
+				depth = max(0, depth-1)
+			case depth > 0:
+			case tok == ";":
+				break tokens
+			default:
+				if res, ok := parseResult(tok); ok {
+					inGame = true
+					result = res
+					finish()
+					continue
+				}
+				tok = strings.TrimLeft(tok, "0123456789.")
+				if tok == "" || strings.HasPrefix(tok, "$") {
+					continue
+				}
+				inGame = true
+				moves = append(moves, tok)
+			}
+		}
+	}
+	finish()
+	if err := sc.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return games, errors.Join(errs...)
+}
+
+// parseTag splits a PGN tag pair like [Result "1-0"].
+func parseTag(line string) (name, value string, ok bool) {
+	line = strings.TrimSuffix(strings.TrimPrefix(line, "["), "]")
+	name, value, ok = strings.Cut(line, " ")
+	if !ok {
+		return "", "", false
+	}
+	return name, strings.Trim(strings.TrimSpace(value), `"`), true
+}
+
+// pgnTokens splits a line of movetext into words, with the comment and
+// variation delimiters and ';' as tokens of their own.
+func pgnTokens(line string) []string {
+	for _, d := range []string{"{", "}", "(", ")", ";"} {
+		line = strings.ReplaceAll(line, d, " "+d+" ")
+	}
+	return strings.Fields(line)
+}
+
+// ReadPositionLog adds the games of a UCCI session log: every "position
+// startpos" or "position fen" command gives a game, with an unknown result.
+// A command is a line of its own or the payload of a line logged by the
+// engine. A position that continues the game of the line before
+// replaces it, so a game logged move by move counts once. It returns the
+// number of games added.
+func (b *BookBuilder) ReadPositionLog(r io.Reader) (int, error) {
+	type game struct {
+		fen   string
+		moves []string
+	}
+	var (
+		games   []game
+		errs    []error
+		lineNum int
+	)
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		lineNum++
+		fen, moves, ok, err := parsePositionCommand(sc.Text())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %w", lineNum, err))
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if n := len(games); n > 0 && games[n-1].fen == fen && len(games[n-1].moves) <= len(moves) &&
+			slices.Equal(games[n-1].moves, moves[:len(games[n-1].moves)]) {
+			games[n-1].moves = moves
+			continue
+		}
+		games = append(games, game{fen, moves})
+	}
+	if err := sc.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	for i, g := range games {
+		if err := b.AddGame(g.fen, g.moves, ResultUnknown); err != nil {
+			errs = append(errs, fmt.Errorf("game %d: %w", i+1, err))
+		}
+	}
+	return len(games), errors.Join(errs...)
+}
+
+// parsePositionCommand returns the start position and moves of a position
+// command in a log line; ok is false if the line holds none. The command is
+// either the whole line or the quoted payload of a logged line.
+func parsePositionCommand(line string) (fen string, moves []string, ok bool, err error) {
+	if _, payload, found := strings.Cut(line, `payload="`); found {
+		line, _, _ = strings.Cut(payload, `"`)
+	}
+	cmd, found := strings.CutPrefix(strings.TrimSpace(line), "position ")
+	if !found {
+		return "", nil, false, nil
+	}
+	args := strings.Fields(cmd)
+	if len(args) == 0 || (args[0] != "startpos" && args[0] != "fen") {
+		return "", nil, false, nil
+	}
+	movesIndex := slices.Index(args, "moves")
+	if movesIndex < 0 {
+		movesIndex = len(args)
+	} else {
+		moves = args[movesIndex+1:]
+	}
+	fen = StartFEN
+	if args[0] == "fen" {
+		if movesIndex == 1 {
+			return "", nil, false, errors.New("position fen without a FEN")
+		}
+		fen = strings.Join(args[1:movesIndex], " ")
+	}
+	return fen, moves, true, nil
+}
@@ -0,0 +1,143 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+const testPGN = `[Event "test"]
+[Result "1-0"]
+
+1. h2e2 h9g7 {the usual reply} 2. b0c2 (2. h0g2 i9h9) i9h9 1-0
+
+[Event "test"]
+[Result "1/2-1/2"]
+1. H2-E2 b7e7 ; same-side cannons
+2. h0g2 1/2-1/2
+
+[Event "test"]
+1. c3c4 $1 g6g5 0-1
+
+[Event "bad"]
+1. h2e2 h2h9 *
+`
+
+// statsOf returns the statistics of move in the position reached by
+// playing moves from the start.
+func statsOf(t *testing.T, b *BookBuilder, moves, move string) BookMoveStats {
+	t.Helper()
+	pos := mustPosition(t, StartFEN)
+	for _, s := range strings.Fields(moves) {
+		m, err := ParseUCIMove(pos, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var st StateInfo
+		pos.DoMove(m, &st)
+	}
+	m, err := ParseUCIMove(pos, move)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, st := range b.Stats() {
+		if st.Key == pos.Key() && st.Move == m {
+			return st
+		}
+	}
+	return BookMoveStats{}
+}
+
+func TestBookBuilderReadPGN(t *testing.T) {
+	b := NewBookBuilder(0, 1)
+	games, err := b.ReadPGN(strings.NewReader(testPGN))
+	if games != 4 {
+		t.Errorf("read %d games, want 4", games)
+	}
+	if err == nil || !strings.Contains(err.Error(), "game 4") {
+		t.Errorf("bad move of game 4 not reported: %v", err)
+	}
+	for _, c := range []struct {
+		moves, move                string
+		games, wins, draws, losses int
+	}{
+		{"", "h2e2", 3, 1, 1, 0},
+		{"", "c3c4", 1, 0, 0, 1},
+		{"h2e2", "h9g7", 1, 0, 0, 1},
+		{"h2e2", "b7e7", 1, 0, 1, 0},
+		{"h2e2 h9g7", "b0c2", 1, 1, 0, 0},
+		{"h2e2 h9g7", "h0g2", 0, 0, 0, 0}, // only in a variation
+		{"c3c4", "g6g5", 1, 1, 0, 0},
+	} {
+		st := statsOf(t, b, c.moves, c.move)
+		if st.Games != c.games || st.Wins != c.wins || st.Draws != c.draws || st.Losses != c.losses {
+			t.Errorf("%s after %q: got %d games +%d =%d -%d, want %d games +%d =%d -%d",
+				c.move, c.moves, st.Games, st.Wins, st.Draws, st.Losses, c.games, c.wins, c.draws, c.losses)
+		}
+	}
+}
+
+func TestBookBuilderFilters(t *testing.T) {
+	b := NewBookBuilder(2, 2)
+	if _, err := b.ReadPGN(strings.NewReader(testPGN)); err == nil {
+		t.Fatal("bad game not reported")
+	}
+	var got []string
+	for _, st := range b.Stats() {
+		got = append(got, Move2Str(st.Move))
+	}
+	// Only the first two plies count, and only moves of two games or more.
+	if strings.Join(got, " ") != "h2e2" {
+		t.Errorf("moves %v, want h2e2", got)
+	}
+}
+
+func TestBookBuilderMergesLogs(t *testing.T) {
+	const log = `ucci
+position startpos
+position startpos moves h2e2
+position startpos moves h2e2 h9g7
+position startpos moves h2e2 h9g7 h0g2
+time="..." level=debug msg="ucci command" payload="position fen ` + StartFEN + ` moves b0c2 h9g7 h2e2 i9h9"
+time="..." level=debug msg="ucci reply" payload="info string position startpos moves g3g4"
+info string bad position startpos moves a3a4
+position startpos moves c3c4
+`
+	b := NewBookBuilder(0, 1)
+	games, err := b.ReadPositionLog(strings.NewReader(log))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if games != 3 {
+		t.Errorf("read %d games, want 3", games)
+	}
+	if _, err := b.ReadPGN(strings.NewReader(testPGN)); err == nil {
+		t.Fatal("bad game not reported")
+	}
+	if st := statsOf(t, b, "", "h2e2"); st.Games != 4 || st.Wins != 1 {
+		t.Errorf("h2e2 after merging: %+v, want 4 games with 1 win", st)
+	}
+	// The second logged game transposes into the first game of the PGN.
+	if st := statsOf(t, b, "h2e2 h9g7 b0c2", "i9h9"); st.Games != 2 || st.Losses != 1 {
+		t.Errorf("i9h9 after merging: %+v, want 2 games with 1 loss", st)
+	}
+
+	book := b.Book()
+	start := mustPosition(t, StartFEN)
+	if m := book.Pick(start, BookBest, nil, nil); Move2Str(m) != "h2e2" {
+		t.Errorf("best book move %s, want h2e2", Move2Str(m))
+	}
+	for _, e := range book.Moves(start) {
+		if Move2Str(e.Move) == "h2e2" && e.Weight != 5 {
+			t.Errorf("h2e2 weight %d, want 5 half points", e.Weight)
+		}
+	}
+	black := mustPosition(t, StartFEN)
+	m, _ := ParseUCIMove(black, "c3c4")
+	var st StateInfo
+	black.DoMove(m, &st)
+	for _, e := range book.Moves(black) {
+		if Move2Str(e.Move) == "g6g5" && e.Weight != 2 {
+			t.Errorf("g6g5 weight %d, want 2", e.Weight)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package engine
+
+// Scale factors shrink the score of the side ahead in endings it cannot
+// or can hardly win.
+const (
+	ScaleDraw    = 0
+	ScaleDrawish = 8
+	ScaleNormal  = 64
+)
+
+// endgameRule is the knowledge about one material signature, from the
+// point of view of the side named first.
+type endgameRule struct {
+	// scale returns the share of its advantage, out of ScaleNormal, that
+	// the strong side keeps; nil keeps it all.
+	scale func(pos *PositionNG, strong Color) int
+	// win is set when the strong side wins by force.
+	win bool
+}
+
+func constScale(sf int) func(*PositionNG, Color) int {
+	return func(*PositionNG, Color) int { return sf }
+}
+
+// endgameRuleNames holds the signatures with an outcome known in theory,
+// named like tablebases with the strong side first.
+var endgameRuleNames = map[string]endgameRule{
+	// A lone rook seldom breaks a full set of defenders, and a rook holds
+	// against a rook with one defender.
+	"KRKAABB":  {scale: constScale(ScaleDrawish)},
+	"KRKNAABB": {scale: constScale(ScaleDrawish)},
+	"KRKCAABB": {scale: constScale(ScaleDrawish)},
+	"KRKR":     {scale: constScale(ScaleDrawish)},
+	"KRAKR":    {scale: constScale(ScaleDrawish)},
+	"KRBKR":    {scale: constScale(ScaleDrawish)},
+
+	// A rook mates the king behind two defenders of one kind, and a knight
+	// or a cannon with an advisor as screen mates the bare king.
+	"KRK":   {win: true},
+	"KRKA":  {win: true},
+	"KRKB":  {win: true},
+	"KRKAA": {win: true},
+	"KRKBB": {win: true},
+	"KNK":   {win: true},
+	"KCAK":  {win: true},
+	"KCAAK": {win: true},
+}
+
+// endgameRules holds endgameRuleNames by materialKey with the strong side
+// first, and endgameRulePieces the most non-king pieces of a rule.
+var (
+	endgameRules      = map[uint64]endgameRule{}
+	endgameRulePieces int
+)
+
+func init() {
+	for name, rule := range endgameRuleNames {
+		m, err := parseMaterial(name)
+		if err != nil {
+			panic(err)
+		}
+		endgameRules[m.key()] = rule
+		endgameRulePieces = max(endgameRulePieces, m.pieces())
+	}
+}
+
+// attackers counts the pieces of c able to cross the river.
+func (pos *PositionNG) attackers(c Color) int {
+	return pos.PieceCount[MakePieceNG(c, ROOK)] + pos.PieceCount[MakePieceNG(c, KNIGHT)] +
+		pos.PieceCount[MakePieceNG(c, CANNON)] + pos.PieceCount[MakePieceNG(c, PAWN)]
+}
+
+// defenders counts the advisors and bishops of c.
+func (pos *PositionNG) defenders(c Color) int {
+	return pos.PieceCount[MakePieceNG(c, ADVISOR)] + pos.PieceCount[MakePieceNG(c, BISHOP)]
+}
+
+// endgameScale returns the share of its advantage, out of ScaleNormal,
+// that strong keeps, and whether it wins by force.
+func (pos *PositionNG) endgameScale(strong Color) (int, bool) {
+	weak := notColor(strong)
+	attackers := pos.attackers(strong)
+	switch {
+	case attackers == 0:
+		// Advisors and bishops never leave their own half.
+		return ScaleDraw, false
+	case attackers == 1 && pos.defenders(strong) == 0:
+		if sf, ok := pos.loneAttackerScale(strong, weak); ok {
+			return sf, false
+		}
+	}
+
+	if int(pos.PiecesAllColor(ALL_PIECES).PopCount())-2 > endgameRulePieces {
+		return ScaleNormal, false
+	}
+	rule, ok := endgameRules[materialKey(pos, strong)]
+	if !ok {
+		return ScaleNormal, false
+	}
+	sf := ScaleNormal
+	if rule.scale != nil {
+		sf = rule.scale(pos, strong)
+	}
+	return sf, rule.win
+}
+
+// loneAttackerScale knows the endings where strong has a single piece and
+// no defenders.
+func (pos *PositionNG) loneAttackerScale(strong, weak Color) (int, bool) {
+	switch {
+	case pos.PieceCount[MakePieceNG(strong, CANNON)] == 1:
+		// A cannon mates only over a screen, and its own king cannot be
+		// one.
+		if pos.PiecesAllColor(ALL_PIECES).PopCount() == 3 {
+			return ScaleDraw, true
+		}
+		if pos.attackers(weak) == 0 {
+			return ScaleDrawish, true
+		}
+	case pos.PieceCount[MakePieceNG(strong, PAWN)] == 1:
+		// A pawn on the last rank no longer reaches the palace, and two
+		// advisors hold any single pawn.
+		sq := Lsb(pos.Pieces(strong, PAWN))
+		if relativeRank(strong, sq) == int(RANK_9) || pos.PieceCount[MakePieceNG(weak, ADVISOR)] == 2 {
+			return ScaleDraw, true
+		}
+	}
+	return 0, false
+}
+
+// scaleEndgame applies the endgame knowledge to score, from red's point
+// of view: the side ahead keeps its share of the score, and a forced win
+// gains VALUE_KNOWN_WIN plus a bonus for driving the king from the
+// middle of its palace.
+func (pos *PositionNG) scaleEndgame(score Value) Value {
+	if score == 0 {
+		return score
+	}
+	strong := Color(WHITE)
+	if score < 0 {
+		strong = BLACK
+	}
+	sf, win := pos.endgameScale(strong)
+	score = score * Value(sf) / ScaleNormal
+	if win {
+		weak := notColor(strong)
+		ksq := pos.KingSQ[weak]
+		dist := abs(int(FileOf(ksq))-int(FILE_E)) + abs(relativeRank(weak, ksq)-1)
+		bonus := VALUE_KNOWN_WIN + Value(20*dist)
+		if strong == WHITE {
+			score += bonus
+		} else {
+			score -= bonus
+		}
+	}
+	return score
+}
@@ -0,0 +1,78 @@
+package engine
+
+import "testing"
+
+func TestEndgameScale(t *testing.T) {
+	for _, c := range []struct {
+		fen    string
+		strong Color
+		sf     int
+		win    bool
+	}{
+		// Only advisors and bishops.
+		{"4k4/9/9/9/9/9/9/4B4/4A4/2BAK4 w - - 0 1", WHITE, ScaleDraw, false},
+		// A lone cannon without and with screens, for either color.
+		{"4k4/9/9/9/9/9/9/9/9/C2K5 w - - 0 1", WHITE, ScaleDraw, false},
+		{"1c3k3/9/9/9/9/9/9/9/9/3K5 b - - 0 1", BLACK, ScaleDraw, false},
+		{"3ak4/4a4/9/9/9/9/9/9/9/C2K5 w - - 0 1", WHITE, ScaleDrawish, false},
+		{"3ak4/9/4n4/9/9/9/9/9/9/C2K5 w - - 0 1", WHITE, ScaleNormal, false},
+		// A pawn on the last rank, a pawn against two advisors and a pawn
+		// that still wins.
+		{"3k3P1/9/9/9/9/9/9/9/9/4K4 w - - 0 1", WHITE, ScaleDraw, false},
+		{"3aka3/9/9/9/4P4/9/9/9/9/4K4 w - - 0 1", WHITE, ScaleDraw, false},
+		{"3k5/9/7P1/9/9/9/9/9/9/4K4 w - - 0 1", WHITE, ScaleNormal, false},
+		// A lone rook against defenders, for either color.
+		{"2bakab2/9/9/9/9/9/9/9/9/R2K5 w - - 0 1", WHITE, ScaleDrawish, false},
+		{"r2k5/9/9/9/9/9/9/9/9/2BAKAB2 b - - 0 1", BLACK, ScaleDrawish, false},
+		{"2bakab2/9/4n4/9/9/9/9/9/9/R2K5 w - - 0 1", WHITE, ScaleDrawish, false},
+		{"2bakab2/9/4c4/9/9/9/9/9/9/R2K5 w - - 0 1", WHITE, ScaleDrawish, false},
+		{"2bak1b2/9/9/9/9/9/9/9/9/R2K5 w - - 0 1", WHITE, ScaleNormal, false},
+		// Rook against rook.
+		{"4k3r/9/9/9/9/9/9/9/9/R2K5 w - - 0 1", WHITE, ScaleDrawish, false},
+		{"4k3r/9/9/9/9/9/9/9/4A4/R2K5 w - - 0 1", WHITE, ScaleDrawish, false},
+		{"4k3r/9/9/9/9/9/9/4B4/9/R2K5 w - - 0 1", WHITE, ScaleDrawish, false},
+		// Forced wins.
+		{krkMateIn3, WHITE, ScaleNormal, true},
+		{"3k5/4a4/9/9/9/9/9/9/9/R3K4 w - - 0 1", WHITE, ScaleNormal, true},
+		{"3k5/9/4b4/9/9/9/9/9/9/R3K4 w - - 0 1", WHITE, ScaleNormal, true},
+		{"3ak4/4a4/9/9/9/9/9/9/9/R2K5 w - - 0 1", WHITE, ScaleNormal, true},
+		{"2b1k1b2/9/9/9/9/9/9/9/9/R2K5 w - - 0 1", WHITE, ScaleNormal, true},
+		{"3k5/9/9/9/9/9/9/9/9/1N2K4 w - - 0 1", WHITE, ScaleNormal, true},
+		{"4k4/9/9/9/9/9/9/9/4A4/C2K5 w - - 0 1", WHITE, ScaleNormal, true},
+		{"4k4/9/9/9/9/9/9/9/4A4/C2K1A3 w - - 0 1", WHITE, ScaleNormal, true},
+		// Positions with more material than any rule are left alone.
+		{initialFen, WHITE, ScaleNormal, false},
+	} {
+		pos := mustPosition(t, c.fen)
+		sf, win := pos.endgameScale(c.strong)
+		if sf != c.sf || win != c.win {
+			t.Errorf("%s: scale %d win %v, want %d %v", c.fen, sf, win, c.sf, c.win)
+		}
+	}
+}
+
+func TestEvaluateEndgameKnowledge(t *testing.T) {
+	// Dead draws keep only the tempo bonus.
+	for _, fen := range []string{
+		"4k4/9/9/9/9/9/9/9/9/C2K5 w - - 0 1",
+		"3k3P1/9/9/9/9/9/9/9/9/4K4 b - - 0 1",
+	} {
+		pos := mustPosition(t, fen)
+		if v := pos.Evaluate(); v != 3 && v != -3 {
+			t.Errorf("%s: evaluation %d, want the tempo bonus only", fen, v)
+		}
+	}
+
+	drawish := mustPosition(t, "2bakab2/9/9/9/9/9/9/9/9/R2K5 w - - 0 1")
+	won := mustPosition(t, "2b1k1b2/9/9/9/9/9/9/9/9/R2K5 w - - 0 1")
+	if v := drawish.Evaluate(); v <= 0 || v >= RookValueEg/4 {
+		t.Errorf("rook against full defenders evaluates %d", v)
+	}
+	if v := won.Evaluate(); v <= VALUE_KNOWN_WIN {
+		t.Errorf("rook against two bishops evaluates %d, want a known win", v)
+	}
+	won = mustPosition(t, "2b1k1b2/9/9/9/9/9/9/9/9/R2K5 b - - 0 1")
+	if v := won.Evaluate(); v >= -VALUE_KNOWN_WIN {
+		t.Errorf("rook against two bishops evaluates %d for black, want a known loss", v)
+	}
+}
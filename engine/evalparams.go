@@ -0,0 +1,497 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Weight is a midgame and an endgame value.
+type Weight struct {
+	MG Value `json:"mg"`
+	EG Value `json:"eg"`
+}
+
+// pieceTypeNames names the piece types in evaluation files.
+var pieceTypeNames = [PIECE_TYPE_NB]string{"", "rook", "advisor", "cannon", "pawn", "knight", "bishop", "king"}
+
+// ByPieceType holds a T per piece type. In JSON it is an object keyed by
+// the piece names; the pieces left out keep their values.
+type ByPieceType[T any] [PIECE_TYPE_NB]T
+
+func (t ByPieceType[T]) MarshalJSON() ([]byte, error) {
+	m := make(map[string]T, PIECE_TYPE_NB)
+	for pt := ROOK; pt < PIECE_TYPE_NB; pt++ {
+		m[pieceTypeNames[pt]] = t[pt]
+	}
+	return json.Marshal(m)
+}
+
+func (t *ByPieceType[T]) UnmarshalJSON(data []byte) error {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	for name, raw := range m {
+		pt := ROOK
+		for pt < PIECE_TYPE_NB && pieceTypeNames[pt] != name {
+			pt++
+		}
+		if pt == PIECE_TYPE_NB {
+			return fmt.Errorf("unknown piece %q", name)
+		}
+		if err := json.Unmarshal(raw, &t[pt]); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// EvalParams holds every weight of the evaluation. Penalties are positive
+// and subtracted. Weights applied per unit, such as per square of mobility
+// or per attacker, say so; the others apply once.
+type EvalParams struct {
+	// PieceValues is the material value of each piece; the king has none.
+	PieceValues ByPieceType[Weight] `json:"pieceValues"`
+
+	// Phase is what each piece adds to the game phase, which blends the
+	// midgame and endgame weights: all pieces on the board is the
+	// midgame, the bare kings the endgame. The king adds nothing.
+	Phase ByPieceType[int] `json:"phase"`
+
+	// Piece-square tables from red's side: index rank*9 + file, rank 0
+	// being red's back rank. Black reads them mirrored.
+	PSTMG ByPieceType[[SQUARE_NB]Value] `json:"pstMG"`
+	PSTEG ByPieceType[[SQUARE_NB]Value] `json:"pstEG"`
+
+	// Pawn structure.
+	PawnCrossed   Weight `json:"pawnCrossed"`   // across the river
+	PawnAdvance   Weight `json:"pawnAdvance"`   // per rank beyond the river bank
+	PawnCentral   Weight `json:"pawnCentral"`   // on the d, e or f file
+	PawnLastRanks Weight `json:"pawnLastRanks"` // on the last two ranks
+	PawnSupport   Weight `json:"pawnSupport"`   // per pawn guarding it
+	PawnNeighbour Weight `json:"pawnNeighbour"` // per pawn beside it
+	PawnBlocked   Weight `json:"pawnBlocked"`   // penalty, blocked before the river
+	PawnKingZone  Weight `json:"pawnKingZone"`  // per attacked square of the king zone
+
+	// Rooks.
+	RookMobility     Weight `json:"rookMobility"`     // per square
+	RookOpenFile     Weight `json:"rookOpenFile"`     // no pawns on the file
+	RookHalfOpenFile Weight `json:"rookHalfOpenFile"` // only enemy pawns on the file
+	RookKingFile     Weight `json:"rookKingFile"`     // facing the enemy king
+	RookKingScreened Weight `json:"rookKingScreened"` // one piece from the enemy king
+
+	// Knights.
+	KnightMobility Weight `json:"knightMobility"` // per square
+	KnightBlocked  Weight `json:"knightBlocked"`  // penalty per lamed leg
+	KnightNearKing Weight `json:"knightNearKing"` // within two squares of the enemy king
+
+	// Cannons.
+	CannonMobility Weight    `json:"cannonMobility"` // per square
+	CannonScreens  [3]Weight `json:"cannonScreens"`  // in line with the enemy king, by pieces between
+
+	// King safety.
+	FullDefence         Weight `json:"fullDefence"`         // both advisors and bishops
+	KingAdvisor         Weight `json:"kingAdvisor"`         // per advisor
+	KingBishop          Weight `json:"kingBishop"`          // per bishop
+	KingHome            Weight `json:"kingHome"`            // king on its starting square
+	KingOffFile         Weight `json:"kingOffFile"`         // penalty, king off the e file
+	KingRaised          Weight `json:"kingRaised"`          // penalty, king above its second rank
+	KingUndefended      Weight `json:"kingUndefended"`      // penalty per attacked square of the zone with no defender
+	RookFacingKing      Weight `json:"rookFacingKing"`      // penalty, enemy rook in line with the king
+	RookScreeningKing   Weight `json:"rookScreeningKing"`   // penalty, with one piece between
+	CannonFacingKing    Weight `json:"cannonFacingKing"`    // penalty, enemy cannon with one piece between
+	CannonScreeningKing Weight `json:"cannonScreeningKing"` // penalty, with two pieces between
+
+	// The attack units of the pieces attacking the king zone count against
+	// a king weakness of KingWeakness less KingWeaknessAdvisor and
+	// KingWeaknessBishop per defender, at least KingWeaknessMin. The
+	// midgame penalty is units*weakness/KingPressureDiv.MG and the endgame
+	// one units*(weakness+KingPressureEGBase)/KingPressureDiv.EG.
+	AttackUnits         ByPieceType[Value] `json:"attackUnits"`
+	KingWeakness        Value              `json:"kingWeakness"`
+	KingWeaknessAdvisor Value              `json:"kingWeaknessAdvisor"`
+	KingWeaknessBishop  Value              `json:"kingWeaknessBishop"`
+	KingWeaknessMin     Value              `json:"kingWeaknessMin"`
+	KingPressureEGBase  Value              `json:"kingPressureEGBase"`
+	KingPressureDiv     Weight             `json:"kingPressureDiv"`
+
+	// Threats against a piece worth v: v/ThreatHangingDiv if undefended;
+	// otherwise the gain over the cheapest attacker divided by
+	// ThreatGainDiv plus ThreatAttacker per attacker, and
+	// v/ThreatOutnumberDiv with more attackers than defenders.
+	ThreatHangingDiv   Weight `json:"threatHangingDiv"`
+	ThreatGainDiv      Weight `json:"threatGainDiv"`
+	ThreatAttacker     Weight `json:"threatAttacker"`
+	ThreatOutnumberDiv Weight `json:"threatOutnumberDiv"`
+
+	// Tempo is added to the score from red's point of view.
+	Tempo Value `json:"tempo"`
+}
+
+// defaultEvalParams are the built-in weights.
+var defaultEvalParams = EvalParams{
+	PieceValues: ByPieceType[Weight]{
+		ROOK:    {RookValueMg, RookValueEg},
+		ADVISOR: {AdvisorValueMg, AdvisorValueEg},
+		CANNON:  {CannonValueMg, CannonValueEg},
+		PAWN:    {PawnValueMg, PawnValueEg},
+		KNIGHT:  {KnightValueMg, KnightValueEg},
+		BISHOP:  {BishopValueMg, BishopValueEg},
+	},
+	Phase: ByPieceType[int]{
+		ROOK:    PhaseRook,
+		ADVISOR: PhaseAdvisor,
+		CANNON:  PhaseCannon,
+		KNIGHT:  PhaseKnight,
+		BISHOP:  PhaseBishop,
+	},
+
+	PSTMG: ByPieceType[[SQUARE_NB]Value]{
+		{}, // NO_PIECE_TYPE
+		{ // ROOK MG - prefers central files and advanced positions
+			-6, -4, -2, 0, 6, 0, -2, -4, -6,
+			-4, 0, 4, 8, 8, 8, 4, 0, -4,
+			-2, 2, 6, 8, 10, 8, 6, 2, -2,
+			0, 4, 8, 10, 12, 10, 8, 4, 0,
+			4, 8, 10, 12, 14, 12, 10, 8, 4,
+			4, 8, 12, 14, 16, 14, 12, 8, 4,
+			8, 12, 16, 18, 20, 18, 16, 12, 8,
+			8, 10, 14, 18, 22, 18, 14, 10, 8,
+			10, 14, 18, 22, 30, 22, 18, 14, 10,
+			8, 10, 12, 16, 18, 16, 12, 10, 8,
+		},
+		{ // ADVISOR MG - only 5 valid positions in palace
+			// Valid: d0(3), f0(5), e1(13), d2(21), f2(23)
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 15, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+		},
+		{ // CANNON MG - center (e-file) is strong, prefers own half with screens
+			0, 0, 2, 4, 8, 4, 2, 0, 0,
+			0, 2, 4, 6, 12, 6, 4, 2, 0,
+			2, 4, 6, 8, 14, 8, 6, 4, 2,
+			0, 2, 4, 6, 10, 6, 4, 2, 0,
+			-2, 0, 2, 4, 8, 4, 2, 0, -2,
+			-2, -2, 0, 2, 6, 2, 0, -2, -2,
+			-4, -2, -2, 0, 4, 0, -2, -2, -4,
+			-6, -4, -4, -2, 0, -2, -4, -4, -6,
+			-6, -4, -4, -2, 0, -2, -4, -4, -6,
+			-8, -6, -6, -4, -2, -4, -6, -6, -8,
+		},
+		{ // PAWN MG - big bonus for crossing river, throat position (rank 7 center) highest
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 4, 0, 0, 0, 0,
+			2, 0, 4, 0, 8, 0, 4, 0, 2,
+			6, 12, 18, 22, 28, 22, 18, 12, 6,
+			10, 20, 28, 34, 40, 34, 28, 20, 10,
+			14, 26, 36, 46, 52, 46, 36, 26, 14,
+			10, 20, 30, 44, 50, 44, 30, 20, 10,
+			2, 6, 10, 18, 20, 18, 10, 6, 2,
+		},
+		{ // KNIGHT MG - center and advanced positions preferred, rim is poor
+			-10, 0, -4, -2, 0, -2, -4, 0, -10,
+			-6, 0, 0, 2, 0, 2, 0, 0, -6,
+			-2, 4, 6, 8, 4, 8, 6, 4, -2,
+			0, 6, 10, 10, 12, 10, 10, 6, 0,
+			4, 8, 12, 14, 16, 14, 12, 8, 4,
+			4, 10, 14, 18, 20, 18, 14, 10, 4,
+			2, 12, 16, 22, 24, 22, 16, 12, 2,
+			0, 8, 14, 20, 22, 20, 14, 8, 0,
+			-4, 4, 10, 18, 20, 18, 10, 4, -4,
+			-10, -2, 0, 8, 10, 8, 0, -2, -10,
+		},
+		{ // BISHOP MG - only 7 valid positions for white: c0,g0,a2,e2,i2,c4,g4
+			// Center bishop (e2) has 4 moves and is strongest
+			0, 0, -2, 0, 0, 0, -2, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			-5, 0, 0, 0, 10, 0, 0, 0, -5,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 5, 0, 0, 0, 5, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+		},
+		{ // KING MG - prefer starting square e0, penalize leaving back rank
+			// Valid: d0-f0, d1-f1, d2-f2
+			0, 0, 0, 2, 10, 2, 0, 0, 0,
+			0, 0, 0, -2, -5, -2, 0, 0, 0,
+			0, 0, 0, -8, -10, -8, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+		},
+	},
+	PSTEG: ByPieceType[[SQUARE_NB]Value]{
+		{}, // NO_PIECE_TYPE
+		{ // ROOK EG - activity matters more, more uniform
+			-4, -2, 0, 2, 4, 2, 0, -2, -4,
+			-2, 2, 4, 6, 6, 6, 4, 2, -2,
+			0, 4, 6, 8, 8, 8, 6, 4, 0,
+			2, 6, 8, 10, 10, 10, 8, 6, 2,
+			4, 8, 10, 12, 12, 12, 10, 8, 4,
+			6, 10, 12, 14, 14, 14, 12, 10, 6,
+			8, 12, 14, 16, 18, 16, 14, 12, 8,
+			8, 12, 14, 18, 20, 18, 14, 12, 8,
+			10, 14, 16, 20, 24, 20, 16, 14, 10,
+			8, 10, 12, 16, 18, 16, 12, 10, 8,
+		},
+		{ // ADVISOR EG
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 10, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+		},
+		{ // CANNON EG - weaker in endgame (fewer screens)
+			-4, -2, -2, 0, 2, 0, -2, -2, -4,
+			-2, 0, 0, 2, 4, 2, 0, 0, -2,
+			-2, 0, 2, 4, 6, 4, 2, 0, -2,
+			-2, 0, 2, 4, 4, 4, 2, 0, -2,
+			-4, -2, 0, 2, 4, 2, 0, -2, -4,
+			-4, -2, -2, 0, 2, 0, -2, -2, -4,
+			-4, -4, -2, 0, 0, 0, -2, -4, -4,
+			-6, -4, -4, -2, -2, -2, -4, -4, -6,
+			-6, -4, -4, -4, -2, -4, -4, -4, -6,
+			-8, -6, -6, -4, -4, -4, -6, -6, -8,
+		},
+		{ // PAWN EG - crossed pawns are even more valuable in endgame
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 6, 0, 0, 0, 0,
+			4, 0, 6, 0, 10, 0, 6, 0, 4,
+			10, 16, 24, 30, 36, 30, 24, 16, 10,
+			16, 28, 36, 44, 52, 44, 36, 28, 16,
+			20, 34, 46, 56, 64, 56, 46, 34, 20,
+			16, 28, 40, 54, 62, 54, 40, 28, 16,
+			4, 10, 16, 24, 28, 24, 16, 10, 4,
+		},
+		{ // KNIGHT EG - stronger in endgame, prefers close to opponent king
+			-8, 0, -2, 0, 2, 0, -2, 0, -8,
+			-4, 2, 4, 6, 4, 6, 4, 2, -4,
+			0, 6, 8, 10, 8, 10, 8, 6, 0,
+			2, 8, 12, 14, 14, 14, 12, 8, 2,
+			4, 10, 14, 18, 18, 18, 14, 10, 4,
+			6, 12, 16, 20, 22, 20, 16, 12, 6,
+			4, 14, 18, 24, 28, 24, 18, 14, 4,
+			2, 10, 16, 22, 26, 22, 16, 10, 2,
+			-2, 6, 12, 20, 24, 20, 12, 6, -2,
+			-6, 0, 4, 10, 14, 10, 4, 0, -6,
+		},
+		{ // BISHOP EG
+			0, 0, -4, 0, 0, 0, -4, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			-5, 0, 0, 0, 5, 0, 0, 0, -5,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+		},
+		{ // KING EG - more active king needed
+			0, 0, 0, -2, 0, -2, 0, 0, 0,
+			0, 0, 0, 0, 2, 0, 0, 0, 0,
+			0, 0, 0, 0, 2, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0, 0,
+		},
+	},
+
+	PawnCrossed:   Weight{18, 28},
+	PawnAdvance:   Weight{4, 7},
+	PawnCentral:   Weight{6, 4},
+	PawnLastRanks: Weight{10, 18},
+	PawnSupport:   Weight{8, 10},
+	PawnNeighbour: Weight{4, 4},
+	PawnBlocked:   Weight{8, 4},
+	PawnKingZone:  Weight{10, 8},
+
+	RookMobility:     Weight{3, 4},
+	RookOpenFile:     Weight{18, 14},
+	RookHalfOpenFile: Weight{10, 8},
+	RookKingFile:     Weight{28, 18},
+	RookKingScreened: Weight{14, 8},
+
+	KnightMobility: Weight{4, 5},
+	KnightBlocked:  Weight{6, 3},
+	KnightNearKing: Weight{18, 12},
+
+	CannonMobility: Weight{2, 2},
+	CannonScreens:  [3]Weight{{6, 0}, {36, 18}, {10, 0}},
+
+	FullDefence:         Weight{32, 22},
+	KingAdvisor:         Weight{10, 6},
+	KingBishop:          Weight{8, 6},
+	KingHome:            Weight{12, 0},
+	KingOffFile:         Weight{10, 0},
+	KingRaised:          Weight{16, 6},
+	KingUndefended:      Weight{12, 6},
+	RookFacingKing:      Weight{48, 26},
+	RookScreeningKing:   Weight{18, 10},
+	CannonFacingKing:    Weight{34, 14},
+	CannonScreeningKing: Weight{10, 0},
+
+	AttackUnits: ByPieceType[Value]{
+		0, // NO_PIECE_TYPE
+		9, // ROOK
+		1, // ADVISOR
+		7, // CANNON
+		3, // PAWN
+		6, // KNIGHT
+		1, // BISHOP
+		0, // KING
+	},
+	KingWeakness:        16,
+	KingWeaknessAdvisor: 3,
+	KingWeaknessBishop:  2,
+	KingWeaknessMin:     4,
+	KingPressureEGBase:  2,
+	KingPressureDiv:     Weight{5, 8},
+
+	ThreatHangingDiv:   Weight{7, 9},
+	ThreatGainDiv:      Weight{10, 12},
+	ThreatAttacker:     Weight{4, 3},
+	ThreatOutnumberDiv: Weight{14, 16},
+
+	Tempo: 3,
+}
+
+// ErrEvalFile reports an evaluation file that cannot be used.
+var ErrEvalFile = errors.New("bad evaluation file")
+
+// DefaultEvalParams returns a copy of the built-in weights.
+func DefaultEvalParams() *EvalParams {
+	p := defaultEvalParams
+	return &p
+}
+
+// CurrentEvalParams returns a copy of the weights set by SetEvalParams.
+func CurrentEvalParams() *EvalParams {
+	p := currentWeights.Load().EvalParams
+	return &p
+}
+
+// SetEvalParams makes p the weights of the positions set up from now on.
+// Positions already set up, and the searches running on them, keep their
+// weights until their SetState, so it may be called while searching.
+func SetEvalParams(p *EvalParams) error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+	currentWeights.Store(newEvalWeights(p))
+	return nil
+}
+
+func (p *EvalParams) validate() error {
+	if p.PieceValues[KING] != (Weight{}) {
+		return fmt.Errorf("%w: the king has no value", ErrEvalFile)
+	}
+	if p.Phase[KING] != 0 {
+		return fmt.Errorf("%w: the king adds no phase", ErrEvalFile)
+	}
+	for pt := ROOK; pt < KING; pt++ {
+		if p.Phase[pt] < 0 {
+			return fmt.Errorf("%w: phase of the %s is negative", ErrEvalFile, pieceTypeNames[pt])
+		}
+	}
+	if p.totalPhase() == 0 {
+		return fmt.Errorf("%w: no piece adds to the phase", ErrEvalFile)
+	}
+	for _, div := range []struct {
+		name string
+		w    Weight
+	}{
+		{"kingPressureDiv", p.KingPressureDiv},
+		{"threatHangingDiv", p.ThreatHangingDiv},
+		{"threatGainDiv", p.ThreatGainDiv},
+		{"threatOutnumberDiv", p.ThreatOutnumberDiv},
+	} {
+		if div.w.MG <= 0 || div.w.EG <= 0 {
+			return fmt.Errorf("%w: %s must be positive", ErrEvalFile, div.name)
+		}
+	}
+	return nil
+}
+
+// totalPhase returns the phase of the full set of pieces.
+func (p *EvalParams) totalPhase() int {
+	total := 0
+	for pt := ROOK; pt < KING; pt++ {
+		total += 2 * maxPieceCount[pt] * p.Phase[pt]
+	}
+	return total
+}
+
+// pieceValueTable lays the piece values out like PieceValue.
+func (p *EvalParams) pieceValueTable() [PHASE_NB][PIECE_NB]Value {
+	var t [PHASE_NB][PIECE_NB]Value
+	for c := Color(WHITE); c < COLOR_NB; c++ {
+		for pt := ROOK; pt < KING; pt++ {
+			t[MG][MakePieceNG(c, pt)] = p.PieceValues[pt].MG
+			t[EG][MakePieceNG(c, pt)] = p.PieceValues[pt].EG
+		}
+	}
+	return t
+}
+
+// ReadEvalParams reads weights in JSON from r. Weights it leaves out keep
+// their default values.
+func ReadEvalParams(r io.Reader) (*EvalParams, error) {
+	p := DefaultEvalParams()
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(p); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrEvalFile, err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// OpenEvalParams reads the weights of the named file.
+func OpenEvalParams(path string) (*EvalParams, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadEvalParams(f)
+}
+
+// Write writes p to w as indented JSON.
+func (p *EvalParams) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(p)
+}
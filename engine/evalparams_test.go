@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEvalParamsRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := DefaultEvalParams().Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"rookOpenFile"`) || !strings.Contains(buf.String(), `"knight"`) {
+		t.Errorf("weights not named in the file:\n%.200s", buf.String())
+	}
+	p, err := ReadEvalParams(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *p != defaultEvalParams {
+		t.Error("weights changed by a write and a read")
+	}
+
+	p, err = ReadEvalParams(strings.NewReader(`{"tempo": 10, "pieceValues": {"rook": {"mg": 1000}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := defaultEvalParams
+	want.Tempo = 10
+	want.PieceValues[ROOK].MG = 1000
+	if *p != want {
+		t.Errorf("partial file: got tempo %d rook %+v, want the other weights kept", p.Tempo, p.PieceValues[ROOK])
+	}
+
+	for name, data := range map[string]string{
+		"unknown weight": `{"tempi": 3}`,
+		"unknown piece":  `{"attackUnits": {"elephant": 1}}`,
+		"zero divisor":   `{"threatGainDiv": {"mg": 0, "eg": 12}}`,
+		"king value":     `{"pieceValues": {"king": {"mg": 5000, "eg": 5000}}}`,
+		"king phase":     `{"phase": {"king": 1}}`,
+		"negative phase": `{"phase": {"rook": -1}}`,
+		"no phase":       `{"phase": {"rook": 0, "advisor": 0, "cannon": 0, "knight": 0, "bishop": 0}}`,
+		"not JSON":       `tempo = 3`,
+	} {
+		if _, err := ReadEvalParams(strings.NewReader(data)); !errors.Is(err, ErrEvalFile) {
+			t.Errorf("%s: got error %v, want ErrEvalFile", name, err)
+		}
+	}
+}
+
+func TestSetEvalParams(t *testing.T) {
+	t.Cleanup(func() {
+		if err := SetEvalParams(DefaultEvalParams()); err != nil {
+			t.Fatal(err)
+		}
+	})
+	const fen = "4ka3/4a4/4b4/9/9/2P6/9/9/4K4/5R3 w - - 0 1"
+	old := mustPosition(t, fen)
+	before := old.Evaluate()
+
+	p := DefaultEvalParams()
+	p.PieceValues[ROOK] = Weight{2000, 2000}
+	p.PSTMG[KING][SQ_E1] += 50
+	p.Tempo = 0
+	if err := SetEvalParams(p); err != nil {
+		t.Fatal(err)
+	}
+	pos := mustPosition(t, fen)
+	if w := pos.weights(); w.pieceValue[EG][B_ROOK] != 2000 || w.PSTMG[KING][SQ_E1] != defaultEvalParams.PSTMG[KING][SQ_E1]+50 {
+		t.Error("lookup tables not updated")
+	}
+	if v := old.Evaluate(); v != before || v != old.evaluateNoCache() {
+		t.Errorf("position set up before changed its evaluation from %d to %d", before, v)
+	}
+	if v := pos.Evaluate(); v <= before || v != pos.evaluateNoCache() || v != pos.EvaluateTrace().Score {
+		t.Errorf("evaluation %d with a stronger rook, %d before; recomputed %d", v, before, pos.evaluateNoCache())
+	}
+	if CurrentEvalParams().Tempo != 0 {
+		t.Error("current weights not returned")
+	}
+
+	// Without the rook's weight the position is an endgame.
+	p.Phase[ROOK] = 0
+	if err := SetEvalParams(p); err != nil {
+		t.Fatal(err)
+	}
+	pos = mustPosition(t, fen)
+	if tr := pos.EvaluateTrace(); tr.Phase != 3 || tr.TotalPhase != 32 || tr.Tapered != pos.weights().taper(3, tr.MG, tr.EG) || pos.Evaluate() != tr.Score {
+		t.Errorf("phase %d/%d with rooks of no weight, want 3/32", tr.Phase, tr.TotalPhase)
+	}
+
+	bad := DefaultEvalParams()
+	bad.KingPressureDiv.EG = 0
+	if err := SetEvalParams(bad); err == nil || CurrentEvalParams().KingPressureDiv.EG == 0 {
+		t.Error("invalid weights set")
+	}
+}
+
+// Weights may change while another searcher searches: its positions keep
+// the weights they were set up with.
+func TestSetEvalParamsWhileSearching(t *testing.T) {
+	t.Cleanup(func() {
+		if err := SetEvalParams(DefaultEvalParams()); err != nil {
+			t.Fatal(err)
+		}
+	})
+	pos := mustPosition(t, initialFen)
+	want := pos.Evaluate()
+	s := NewSearcher()
+	s.SetReporter(nil)
+	result := s.Start(pos, SearchLimits{Depth: 5})
+	p := DefaultEvalParams()
+	p.Tempo = 50
+	for range 10 {
+		if err := SetEvalParams(p); err != nil {
+			t.Fatal(err)
+		}
+		if err := SetEvalParams(DefaultEvalParams()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-result
+	if got := pos.Evaluate(); got != want {
+		t.Errorf("evaluation %d after the search, %d before", got, want)
+	}
+}
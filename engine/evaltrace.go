@@ -0,0 +1,147 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EvalTerm names a part of the evaluation.
+type EvalTerm int
+
+const (
+	TermMaterial EvalTerm = iota
+	TermPST
+	TermPawns
+	TermPieces
+	TermKingSafety
+	TermThreats
+	EVAL_TERM_NB
+)
+
+var evalTermNames = [EVAL_TERM_NB]string{
+	"Material", "PST", "Pawns", "Pieces", "King safety", "Threats",
+}
+
+func (t EvalTerm) String() string {
+	if t < 0 || t >= EVAL_TERM_NB {
+		return fmt.Sprintf("EvalTerm(%d)", int(t))
+	}
+	return evalTermNames[t]
+}
+
+// EvalTrace is the breakdown of an evaluation into its terms.
+type EvalTrace struct {
+	// Terms holds what each term gives each color in the midgame and the
+	// endgame.
+	Terms [EVAL_TERM_NB][COLOR_NB][PHASE_NB]Value
+
+	// MG and EG are the sums of the terms, red minus black, and Tapered
+	// their interpolation by Phase, from 0 in the endgame to TotalPhase,
+	// that of the full set of pieces under the weights of the position.
+	MG, EG     Value
+	Phase      int
+	TotalPhase int
+	Tapered    Value
+
+	// Scale is the endgame scale factor, out of ScaleNormal, of the side
+	// ahead and KnownWin whether it wins by force; Scaled is Tapered after
+	// both.
+	Scale    int
+	KnownWin bool
+	Scaled   Value
+
+	// Tempo is added to Scaled, and Score is the result from the side to
+	// move, the value of Evaluate.
+	Tempo Value
+	Score Value
+}
+
+// EvaluateTrace evaluates pos from scratch like Evaluate, keeping every
+// term apart.
+func (pos *PositionNG) EvaluateTrace() EvalTrace {
+	var tr EvalTrace
+	w := pos.weights()
+	phase := 0
+	for sq := Square(0); sq < SQUARE_NB; sq++ {
+		piece := pos.Board[sq]
+		if piece == NO_PIECE {
+			continue
+		}
+		pt := TypeOf(piece)
+		c := ColorOf(piece)
+		idx := pstIndex(piece, sq)
+		if pt != KING {
+			tr.Terms[TermMaterial][c][MG] += w.pieceValue[MG][piece]
+			tr.Terms[TermMaterial][c][EG] += w.pieceValue[EG][piece]
+			phase += w.Phase[pt]
+		}
+		tr.Terms[TermPST][c][MG] += w.PSTMG[pt][idx]
+		tr.Terms[TermPST][c][EG] += w.PSTEG[pt][idx]
+	}
+	tr.TotalPhase = w.totalPhase
+	tr.Phase = min(phase, tr.TotalPhase)
+
+	occupied := pos.PiecesAllColor(ALL_PIECES)
+	for _, t := range []struct {
+		term EvalTerm
+		add  func(mgScore, egScore *[COLOR_NB]Value, occupied Bitboard)
+	}{
+		{TermPawns, pos.addPawnStructureTerms},
+		{TermPieces, pos.addPieceActivityTerms},
+		{TermKingSafety, pos.addKingSafetyTerms},
+		{TermThreats, pos.addThreatTerms},
+	} {
+		var mgScore, egScore [COLOR_NB]Value
+		t.add(&mgScore, &egScore, occupied)
+		for c := Color(WHITE); c < COLOR_NB; c++ {
+			tr.Terms[t.term][c] = [PHASE_NB]Value{mgScore[c], egScore[c]}
+		}
+	}
+
+	for term := range EVAL_TERM_NB {
+		tr.MG += tr.Terms[term][WHITE][MG] - tr.Terms[term][BLACK][MG]
+		tr.EG += tr.Terms[term][WHITE][EG] - tr.Terms[term][BLACK][EG]
+	}
+	tr.Tapered = w.taper(tr.Phase, tr.MG, tr.EG)
+	tr.Scale = ScaleNormal
+	if tr.Tapered != 0 {
+		strong := Color(WHITE)
+		if tr.Tapered < 0 {
+			strong = BLACK
+		}
+		tr.Scale, tr.KnownWin = pos.endgameScale(strong)
+	}
+	tr.Scaled = pos.scaleEndgame(tr.Tapered)
+	tr.Tempo = w.Tempo
+	tr.Score = tr.Scaled + tr.Tempo
+	if pos.SideToMove == BLACK {
+		tr.Score = -tr.Score
+	}
+	return tr
+}
+
+// String formats tr as a table of the terms followed by the steps from
+// their totals to the score.
+func (tr EvalTrace) String() string {
+	var b strings.Builder
+	const row = "%12s | %6s %6s | %6s %6s | %6s %6s\n"
+	fmt.Fprintf(&b, row, "Term", "Red MG", "EG", "Blk MG", "EG", "Tot MG", "EG")
+	fmt.Fprintf(&b, "%s\n", strings.Repeat("-", 12+3*16))
+	for term := range EVAL_TERM_NB {
+		t := tr.Terms[term]
+		fmt.Fprintf(&b, "%12s | %6d %6d | %6d %6d | %6d %6d\n", term,
+			t[WHITE][MG], t[WHITE][EG], t[BLACK][MG], t[BLACK][EG],
+			t[WHITE][MG]-t[BLACK][MG], t[WHITE][EG]-t[BLACK][EG])
+	}
+	fmt.Fprintf(&b, "%s\n", strings.Repeat("-", 12+3*16))
+	fmt.Fprintf(&b, "%12s | %6s %6s | %6s %6s | %6d %6d\n", "Total", "", "", "", "", tr.MG, tr.EG)
+	fmt.Fprintf(&b, "Phase %d/%d: tapered %d\n", tr.Phase, tr.TotalPhase, tr.Tapered)
+	fmt.Fprintf(&b, "Endgame scale %d/%d", tr.Scale, ScaleNormal)
+	if tr.KnownWin {
+		fmt.Fprintf(&b, ", known win")
+	}
+	fmt.Fprintf(&b, ": %d\n", tr.Scaled)
+	fmt.Fprintf(&b, "Tempo %+d: %d for red\n", tr.Tempo, tr.Scaled+tr.Tempo)
+	fmt.Fprintf(&b, "Evaluation %d for the side to move\n", tr.Score)
+	return b.String()
+}
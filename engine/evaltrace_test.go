@@ -0,0 +1,40 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEvaluateTraceMatchesEvaluate(t *testing.T) {
+	for _, fen := range append(benchPositions,
+		"2b1k1b2/9/9/9/9/9/9/9/9/R2K5 b - - 0 1",
+		"3k3P1/9/9/9/9/9/9/9/9/4K4 w - - 0 1",
+	) {
+		pos := mustPosition(t, fen)
+		tr := pos.EvaluateTrace()
+		if tr.Score != pos.Evaluate() {
+			t.Errorf("%s: trace score %d, Evaluate %d", fen, tr.Score, pos.Evaluate())
+		}
+		if tr.Phase != pos.gamePhase() {
+			t.Errorf("%s: trace phase %d, want %d", fen, tr.Phase, pos.gamePhase())
+		}
+		var mat [COLOR_NB]Value
+		for c := Color(WHITE); c < COLOR_NB; c++ {
+			mat[c] = pos.St.Top().Material[c]
+		}
+		if tr.Terms[TermMaterial][WHITE][MG] != mat[WHITE] || tr.Terms[TermMaterial][BLACK][MG] != mat[BLACK] {
+			t.Errorf("%s: trace material %v, want %v", fen, tr.Terms[TermMaterial], mat)
+		}
+	}
+
+	pos := mustPosition(t, "2b1k1b2/9/9/9/9/9/9/9/9/R2K5 w - - 0 1")
+	tr := pos.EvaluateTrace()
+	if !tr.KnownWin || !strings.Contains(tr.String(), "known win") {
+		t.Errorf("rook against two bishops not traced as a known win:\n%s", tr)
+	}
+	for term := range EVAL_TERM_NB {
+		if !strings.Contains(tr.String(), term.String()) {
+			t.Errorf("%s missing from the trace:\n%s", term, tr)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package engine
 
-// Phase weights for game phase calculation.
+import "sync/atomic"
+
+// Default phase weights for game phase calculation, EvalParams.Phase.
 // Higher values mean the piece contributes more to "midgame-ness".
 const (
 	PhaseRook    = 6
@@ -8,15 +10,20 @@ const (
 	PhaseCannon  = 3
 	PhaseAdvisor = 1
 	PhaseBishop  = 1
-	TotalPhase   = 2 * (2*PhaseRook + 2*PhaseKnight + 2*PhaseCannon + 2*PhaseAdvisor + 2*PhaseBishop) // 56
 )
 
-// gamePhase returns the current game phase (0 = endgame, TotalPhase = midgame).
+// TotalPhase is the phase of the full set of pieces under the built-in
+// weights.
+const TotalPhase = 2 * (2*PhaseRook + 2*PhaseKnight + 2*PhaseCannon + 2*PhaseAdvisor + 2*PhaseBishop) // 56
+
+// gamePhase returns the current game phase (0 = endgame, the total phase
+// of the weights = midgame).
 func (pos *PositionNG) gamePhase() int {
+	w := pos.weights()
 	if pos.St != nil && len(pos.St) > 0 {
 		phase := pos.St.Top().Phase
-		if phase > TotalPhase {
-			return TotalPhase
+		if phase > w.totalPhase {
+			return w.totalPhase
 		}
 		if phase < 0 {
 			return 0
@@ -24,231 +31,41 @@ func (pos *PositionNG) gamePhase() int {
 		return phase
 	}
 	phase := 0
-	phase += pos.PieceCount[W_ROOK] * PhaseRook
-	phase += pos.PieceCount[B_ROOK] * PhaseRook
-	phase += pos.PieceCount[W_KNIGHT] * PhaseKnight
-	phase += pos.PieceCount[B_KNIGHT] * PhaseKnight
-	phase += pos.PieceCount[W_CANNON] * PhaseCannon
-	phase += pos.PieceCount[B_CANNON] * PhaseCannon
-	phase += pos.PieceCount[W_ADVISOR] * PhaseAdvisor
-	phase += pos.PieceCount[B_ADVISOR] * PhaseAdvisor
-	phase += pos.PieceCount[W_BISHOP] * PhaseBishop
-	phase += pos.PieceCount[B_BISHOP] * PhaseBishop
-	if phase > TotalPhase {
-		phase = TotalPhase
+	for pt := ROOK; pt < KING; pt++ {
+		phase += (pos.PieceCount[MakePieceNG(WHITE, pt)] + pos.PieceCount[MakePieceNG(BLACK, pt)]) * w.Phase[pt]
+	}
+	if phase > w.totalPhase {
+		phase = w.totalPhase
 	}
 	return phase
 }
 
-func phaseContribution(pt PieceType) int {
-	switch pt {
-	case ROOK:
-		return PhaseRook
-	case KNIGHT:
-		return PhaseKnight
-	case CANNON:
-		return PhaseCannon
-	case ADVISOR:
-		return PhaseAdvisor
-	case BISHOP:
-		return PhaseBishop
-	default:
-		return 0
-	}
+// evalWeights are evaluation weights with the tables derived from them.
+// They are never modified once in use, so searches may go on reading them
+// while SetEvalParams installs others.
+type evalWeights struct {
+	EvalParams
+	pieceValue [PHASE_NB][PIECE_NB]Value
+	totalPhase int
 }
 
-var attackUnit = [PIECE_TYPE_NB]Value{
-	0, // NO_PIECE_TYPE
-	9, // ROOK
-	1, // ADVISOR
-	7, // CANNON
-	3, // PAWN
-	6, // KNIGHT
-	1, // BISHOP
-	0, // KING
+func newEvalWeights(p *EvalParams) *evalWeights {
+	return &evalWeights{EvalParams: *p, pieceValue: p.pieceValueTable(), totalPhase: p.totalPhase()}
 }
 
-// Midgame piece-square tables (positional bonus, from White's perspective).
-// Rank 0 = White's back rank, Rank 9 = opponent's back rank.
-// Array index = rank*9 + file.
-var pstMG = [PIECE_TYPE_NB][SQUARE_NB]Value{
-	{}, // NO_PIECE_TYPE
-	{ // ROOK MG - prefers central files and advanced positions
-		-6, -4, -2, 0, 6, 0, -2, -4, -6,
-		-4, 0, 4, 8, 8, 8, 4, 0, -4,
-		-2, 2, 6, 8, 10, 8, 6, 2, -2,
-		0, 4, 8, 10, 12, 10, 8, 4, 0,
-		4, 8, 10, 12, 14, 12, 10, 8, 4,
-		4, 8, 12, 14, 16, 14, 12, 8, 4,
-		8, 12, 16, 18, 20, 18, 16, 12, 8,
-		8, 10, 14, 18, 22, 18, 14, 10, 8,
-		10, 14, 18, 22, 30, 22, 18, 14, 10,
-		8, 10, 12, 16, 18, 16, 12, 10, 8,
-	},
-	{ // ADVISOR MG - only 5 valid positions in palace
-		// Valid: d0(3), f0(5), e1(13), d2(21), f2(23)
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 15, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-	},
-	{ // CANNON MG - center (e-file) is strong, prefers own half with screens
-		0, 0, 2, 4, 8, 4, 2, 0, 0,
-		0, 2, 4, 6, 12, 6, 4, 2, 0,
-		2, 4, 6, 8, 14, 8, 6, 4, 2,
-		0, 2, 4, 6, 10, 6, 4, 2, 0,
-		-2, 0, 2, 4, 8, 4, 2, 0, -2,
-		-2, -2, 0, 2, 6, 2, 0, -2, -2,
-		-4, -2, -2, 0, 4, 0, -2, -2, -4,
-		-6, -4, -4, -2, 0, -2, -4, -4, -6,
-		-6, -4, -4, -2, 0, -2, -4, -4, -6,
-		-8, -6, -6, -4, -2, -4, -6, -6, -8,
-	},
-	{ // PAWN MG - big bonus for crossing river, throat position (rank 7 center) highest
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 4, 0, 0, 0, 0,
-		2, 0, 4, 0, 8, 0, 4, 0, 2,
-		6, 12, 18, 22, 28, 22, 18, 12, 6,
-		10, 20, 28, 34, 40, 34, 28, 20, 10,
-		14, 26, 36, 46, 52, 46, 36, 26, 14,
-		10, 20, 30, 44, 50, 44, 30, 20, 10,
-		2, 6, 10, 18, 20, 18, 10, 6, 2,
-	},
-	{ // KNIGHT MG - center and advanced positions preferred, rim is poor
-		-10, 0, -4, -2, 0, -2, -4, 0, -10,
-		-6, 0, 0, 2, 0, 2, 0, 0, -6,
-		-2, 4, 6, 8, 4, 8, 6, 4, -2,
-		0, 6, 10, 10, 12, 10, 10, 6, 0,
-		4, 8, 12, 14, 16, 14, 12, 8, 4,
-		4, 10, 14, 18, 20, 18, 14, 10, 4,
-		2, 12, 16, 22, 24, 22, 16, 12, 2,
-		0, 8, 14, 20, 22, 20, 14, 8, 0,
-		-4, 4, 10, 18, 20, 18, 10, 4, -4,
-		-10, -2, 0, 8, 10, 8, 0, -2, -10,
-	},
-	{ // BISHOP MG - only 7 valid positions for white: c0,g0,a2,e2,i2,c4,g4
-		// Center bishop (e2) has 4 moves and is strongest
-		0, 0, -2, 0, 0, 0, -2, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		-5, 0, 0, 0, 10, 0, 0, 0, -5,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 5, 0, 0, 0, 5, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-	},
-	{ // KING MG - prefer starting square e0, penalize leaving back rank
-		// Valid: d0-f0, d1-f1, d2-f2
-		0, 0, 0, 2, 10, 2, 0, 0, 0,
-		0, 0, 0, -2, -5, -2, 0, 0, 0,
-		0, 0, 0, -8, -10, -8, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-	},
+// currentWeights are the weights that positions take when set up.
+var currentWeights atomic.Pointer[evalWeights]
+
+func init() {
+	currentWeights.Store(newEvalWeights(&defaultEvalParams))
 }
 
-// Endgame piece-square tables.
-var pstEG = [PIECE_TYPE_NB][SQUARE_NB]Value{
-	{}, // NO_PIECE_TYPE
-	{ // ROOK EG - activity matters more, more uniform
-		-4, -2, 0, 2, 4, 2, 0, -2, -4,
-		-2, 2, 4, 6, 6, 6, 4, 2, -2,
-		0, 4, 6, 8, 8, 8, 6, 4, 0,
-		2, 6, 8, 10, 10, 10, 8, 6, 2,
-		4, 8, 10, 12, 12, 12, 10, 8, 4,
-		6, 10, 12, 14, 14, 14, 12, 10, 6,
-		8, 12, 14, 16, 18, 16, 14, 12, 8,
-		8, 12, 14, 18, 20, 18, 14, 12, 8,
-		10, 14, 16, 20, 24, 20, 16, 14, 10,
-		8, 10, 12, 16, 18, 16, 12, 10, 8,
-	},
-	{ // ADVISOR EG
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 10, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-	},
-	{ // CANNON EG - weaker in endgame (fewer screens)
-		-4, -2, -2, 0, 2, 0, -2, -2, -4,
-		-2, 0, 0, 2, 4, 2, 0, 0, -2,
-		-2, 0, 2, 4, 6, 4, 2, 0, -2,
-		-2, 0, 2, 4, 4, 4, 2, 0, -2,
-		-4, -2, 0, 2, 4, 2, 0, -2, -4,
-		-4, -2, -2, 0, 2, 0, -2, -2, -4,
-		-4, -4, -2, 0, 0, 0, -2, -4, -4,
-		-6, -4, -4, -2, -2, -2, -4, -4, -6,
-		-6, -4, -4, -4, -2, -4, -4, -4, -6,
-		-8, -6, -6, -4, -4, -4, -6, -6, -8,
-	},
-	{ // PAWN EG - crossed pawns are even more valuable in endgame
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 6, 0, 0, 0, 0,
-		4, 0, 6, 0, 10, 0, 6, 0, 4,
-		10, 16, 24, 30, 36, 30, 24, 16, 10,
-		16, 28, 36, 44, 52, 44, 36, 28, 16,
-		20, 34, 46, 56, 64, 56, 46, 34, 20,
-		16, 28, 40, 54, 62, 54, 40, 28, 16,
-		4, 10, 16, 24, 28, 24, 16, 10, 4,
-	},
-	{ // KNIGHT EG - stronger in endgame, prefers close to opponent king
-		-8, 0, -2, 0, 2, 0, -2, 0, -8,
-		-4, 2, 4, 6, 4, 6, 4, 2, -4,
-		0, 6, 8, 10, 8, 10, 8, 6, 0,
-		2, 8, 12, 14, 14, 14, 12, 8, 2,
-		4, 10, 14, 18, 18, 18, 14, 10, 4,
-		6, 12, 16, 20, 22, 20, 16, 12, 6,
-		4, 14, 18, 24, 28, 24, 18, 14, 4,
-		2, 10, 16, 22, 26, 22, 16, 10, 2,
-		-2, 6, 12, 20, 24, 20, 12, 6, -2,
-		-6, 0, 4, 10, 14, 10, 4, 0, -6,
-	},
-	{ // BISHOP EG
-		0, 0, -4, 0, 0, 0, -4, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		-5, 0, 0, 0, 5, 0, 0, 0, -5,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-	},
-	{ // KING EG - more active king needed
-		0, 0, 0, -2, 0, -2, 0, 0, 0,
-		0, 0, 0, 0, 2, 0, 0, 0, 0,
-		0, 0, 0, 0, 2, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0,
-	},
+// weights returns the evaluation weights of pos, those its SetState took.
+func (pos *PositionNG) weights() *evalWeights {
+	if pos.eval == nil {
+		return currentWeights.Load()
+	}
+	return pos.eval
 }
 
 func flipSquare(sq Square) Square {
@@ -352,9 +169,10 @@ func fileBitboard(f File) Bitboard {
 
 func attackWeight(pos *PositionNG, attackers Bitboard) Value {
 	var units Value
+	attackUnits := &pos.weights().AttackUnits
 	for attackers.IsNotZero() {
 		sq := PopLsb(&attackers)
-		units += attackUnit[TypeOf(pos.PieceOn(sq))]
+		units += attackUnits[TypeOf(pos.PieceOn(sq))]
 	}
 	return units
 }
@@ -367,10 +185,11 @@ func leastAttackerValue(pos *PositionNG, attackers Bitboard) Value {
 	if pt == NO_PIECE_TYPE {
 		return VALUE_ZERO
 	}
-	return PieceValue[MG][MakePieceNG(WHITE, pt)]
+	return pos.weights().pieceValue[MG][MakePieceNG(WHITE, pt)]
 }
 
 func (pos *PositionNG) recomputeEvalBase() (int, [COLOR_NB]Value, [COLOR_NB]Value) {
+	w := pos.weights()
 	phase := 0
 	var mgBase, egBase [COLOR_NB]Value
 	for sq := Square(0); sq < SQUARE_NB; sq++ {
@@ -385,20 +204,21 @@ func (pos *PositionNG) recomputeEvalBase() (int, [COLOR_NB]Value, [COLOR_NB]Valu
 		color := ColorOf(piece)
 		idx := pstIndex(piece, sq)
 		if pt != KING {
-			mgBase[color] += PieceValue[MG][piece]
-			egBase[color] += PieceValue[EG][piece]
-			phase += phaseContribution(pt)
+			mgBase[color] += w.pieceValue[MG][piece]
+			egBase[color] += w.pieceValue[EG][piece]
+			phase += w.Phase[pt]
 		}
-		mgBase[color] += pstMG[pt][idx]
-		egBase[color] += pstEG[pt][idx]
+		mgBase[color] += w.PSTMG[pt][idx]
+		egBase[color] += w.PSTEG[pt][idx]
 	}
-	if phase > TotalPhase {
-		phase = TotalPhase
+	if phase > w.totalPhase {
+		phase = w.totalPhase
 	}
 	return phase, mgBase, egBase
 }
 
 func (pos *PositionNG) addPawnStructureTerms(mgScore, egScore *[COLOR_NB]Value, occupied Bitboard) {
+	w := pos.weights()
 	for c := Color(WHITE); c < COLOR_NB; c++ {
 		opp := notColor(c)
 		oppZone := kingZone(opp, pos.KingSQ[opp])
@@ -408,49 +228,50 @@ func (pos *PositionNG) addPawnStructureTerms(mgScore, egScore *[COLOR_NB]Value,
 			relRank := relativeRank(c, sq)
 			advanced := max(relRank-4, 0)
 			if crossedRiver(c, sq) {
-				mgScore[c] += 18 + Value(advanced*4)
-				egScore[c] += 28 + Value(advanced*7)
+				mgScore[c] += w.PawnCrossed.MG + Value(advanced)*w.PawnAdvance.MG
+				egScore[c] += w.PawnCrossed.EG + Value(advanced)*w.PawnAdvance.EG
 			}
 			file := FileOf(sq)
 			if file >= FILE_D && file <= FILE_F {
-				mgScore[c] += 6
-				egScore[c] += 4
+				mgScore[c] += w.PawnCentral.MG
+				egScore[c] += w.PawnCentral.EG
 			}
 			if relRank >= 8 {
-				mgScore[c] += 10
-				egScore[c] += 18
+				mgScore[c] += w.PawnLastRanks.MG
+				egScore[c] += w.PawnLastRanks.EG
 			}
 
 			support := PawnAttacksTo[c][sq].And(pos.Pieces(c, PAWN))
 			if support.IsNotZero() {
 				count := Value(support.PopCount())
-				mgScore[c] += 8 * count
-				egScore[c] += 10 * count
+				mgScore[c] += w.PawnSupport.MG * count
+				egScore[c] += w.PawnSupport.EG * count
 			}
 			if file > FILE_A && pos.PieceOn(MakeSquareNG(file-1, RankOf(sq))) == MakePieceNG(c, PAWN) {
-				mgScore[c] += 4
-				egScore[c] += 4
+				mgScore[c] += w.PawnNeighbour.MG
+				egScore[c] += w.PawnNeighbour.EG
 			}
 			if file < FILE_I && pos.PieceOn(MakeSquareNG(file+1, RankOf(sq))) == MakePieceNG(c, PAWN) {
-				mgScore[c] += 4
-				egScore[c] += 4
+				mgScore[c] += w.PawnNeighbour.MG
+				egScore[c] += w.PawnNeighbour.EG
 			}
 
 			if frontSq, ok := forwardSquare(c, sq); ok && !crossedRiver(c, sq) && pos.PieceOn(frontSq) != NO_PIECE {
-				mgScore[c] -= 8
-				egScore[c] -= 4
+				mgScore[c] -= w.PawnBlocked.MG
+				egScore[c] -= w.PawnBlocked.EG
 			}
 
 			pressure := PawnAttacks[c][sq].And(oppZone).PopCount()
 			if pressure > 0 {
-				mgScore[c] += Value(pressure) * 10
-				egScore[c] += Value(pressure) * 8
+				mgScore[c] += Value(pressure) * w.PawnKingZone.MG
+				egScore[c] += Value(pressure) * w.PawnKingZone.EG
 			}
 		}
 	}
 }
 
 func (pos *PositionNG) addPieceActivityTerms(mgScore, egScore *[COLOR_NB]Value, occupied Bitboard) {
+	w := pos.weights()
 	for c := Color(WHITE); c < COLOR_NB; c++ {
 		opp := notColor(c)
 		oppKingSq := pos.KingSQ[opp]
@@ -459,27 +280,27 @@ func (pos *PositionNG) addPieceActivityTerms(mgScore, egScore *[COLOR_NB]Value,
 		for rookBB.IsNotZero() {
 			sq := PopLsb(&rookBB)
 			mobility := Value(AttacksBB(ROOK, sq, occupied).PopCount())
-			mgScore[c] += mobility * 3
-			egScore[c] += mobility * 4
+			mgScore[c] += mobility * w.RookMobility.MG
+			egScore[c] += mobility * w.RookMobility.EG
 
 			fileOcc := occupied.And(fileBitboard(FileOf(sq)))
 			ownPawns := pos.Pieces(c, PAWN).And(fileOcc).PopCount()
 			oppPawns := pos.Pieces(opp, PAWN).And(fileOcc).PopCount()
 			if ownPawns == 0 && oppPawns == 0 {
-				mgScore[c] += 18
-				egScore[c] += 14
+				mgScore[c] += w.RookOpenFile.MG
+				egScore[c] += w.RookOpenFile.EG
 			} else if ownPawns == 0 {
-				mgScore[c] += 10
-				egScore[c] += 8
+				mgScore[c] += w.RookHalfOpenFile.MG
+				egScore[c] += w.RookHalfOpenFile.EG
 			}
 			if FileOf(sq) == FileOf(oppKingSq) {
 				between := BetweenBB[sq][oppKingSq].And(occupied).PopCount()
 				if between == 0 {
-					mgScore[c] += 28
-					egScore[c] += 18
+					mgScore[c] += w.RookKingFile.MG
+					egScore[c] += w.RookKingFile.EG
 				} else if between == 1 {
-					mgScore[c] += 14
-					egScore[c] += 8
+					mgScore[c] += w.RookKingScreened.MG
+					egScore[c] += w.RookKingScreened.EG
 				}
 			}
 		}
@@ -490,13 +311,13 @@ func (pos *PositionNG) addPieceActivityTerms(mgScore, egScore *[COLOR_NB]Value,
 			rawMobility := Value(AttacksBBEmptyOcc(KNIGHT, sq).PopCount())
 			mobility := Value(AttacksBB(KNIGHT, sq, occupied).PopCount())
 			blocked := rawMobility - mobility
-			mgScore[c] += mobility * 4
-			egScore[c] += mobility * 5
-			mgScore[c] -= blocked * 6
-			egScore[c] -= blocked * 3
+			mgScore[c] += mobility * w.KnightMobility.MG
+			egScore[c] += mobility * w.KnightMobility.EG
+			mgScore[c] -= blocked * w.KnightBlocked.MG
+			egScore[c] -= blocked * w.KnightBlocked.EG
 			if Distance(sq, oppKingSq) <= 2 {
-				mgScore[c] += 18
-				egScore[c] += 12
+				mgScore[c] += w.KnightNearKing.MG
+				egScore[c] += w.KnightNearKing.EG
 			}
 		}
 
@@ -504,19 +325,14 @@ func (pos *PositionNG) addPieceActivityTerms(mgScore, egScore *[COLOR_NB]Value,
 		for cannonBB.IsNotZero() {
 			sq := PopLsb(&cannonBB)
 			mobility := Value(AttacksBB(CANNON, sq, occupied).PopCount())
-			mgScore[c] += mobility * 2
-			egScore[c] += mobility * 2
+			mgScore[c] += mobility * w.CannonMobility.MG
+			egScore[c] += mobility * w.CannonMobility.EG
 
 			if LineBB[sq][oppKingSq].IsNotZero() {
 				screens := BetweenBB[sq][oppKingSq].And(occupied).PopCount()
-				switch screens {
-				case 1:
-					mgScore[c] += 36
-					egScore[c] += 18
-				case 2:
-					mgScore[c] += 10
-				case 0:
-					mgScore[c] += 6
+				if screens < uint(len(w.CannonScreens)) {
+					mgScore[c] += w.CannonScreens[screens].MG
+					egScore[c] += w.CannonScreens[screens].EG
 				}
 			}
 		}
@@ -524,6 +340,7 @@ func (pos *PositionNG) addPieceActivityTerms(mgScore, egScore *[COLOR_NB]Value,
 }
 
 func (pos *PositionNG) addKingSafetyTerms(mgScore, egScore *[COLOR_NB]Value, occupied Bitboard) {
+	w := pos.weights()
 	for c := Color(WHITE); c < COLOR_NB; c++ {
 		opp := notColor(c)
 		kingSq := pos.KingSQ[c]
@@ -532,28 +349,30 @@ func (pos *PositionNG) addKingSafetyTerms(mgScore, egScore *[COLOR_NB]Value, occ
 		bishopCount := pos.PieceCount[MakePieceNG(c, BISHOP)]
 
 		if advisorCount == 2 && bishopCount == 2 {
-			mgScore[c] += 32
-			egScore[c] += 22
+			mgScore[c] += w.FullDefence.MG
+			egScore[c] += w.FullDefence.EG
 		}
-		mgScore[c] += Value(advisorCount * 10)
-		egScore[c] += Value(advisorCount * 6)
-		mgScore[c] += Value(bishopCount * 8)
-		egScore[c] += Value(bishopCount * 6)
+		mgScore[c] += Value(advisorCount) * w.KingAdvisor.MG
+		egScore[c] += Value(advisorCount) * w.KingAdvisor.EG
+		mgScore[c] += Value(bishopCount) * w.KingBishop.MG
+		egScore[c] += Value(bishopCount) * w.KingBishop.EG
 
 		if kingSq == kingStartSquare(c) {
-			mgScore[c] += 12
+			mgScore[c] += w.KingHome.MG
+			egScore[c] += w.KingHome.EG
 		}
 		if FileOf(kingSq) != FILE_E {
-			mgScore[c] -= 10
+			mgScore[c] -= w.KingOffFile.MG
+			egScore[c] -= w.KingOffFile.EG
 		}
 		if relativeRank(c, kingSq) > 1 {
-			mgScore[c] -= 16
-			egScore[c] -= 6
+			mgScore[c] -= w.KingRaised.MG
+			egScore[c] -= w.KingRaised.EG
 		}
 
-		weakness := Value(16 - 3*advisorCount - 2*bishopCount)
-		if weakness < 4 {
-			weakness = 4
+		weakness := w.KingWeakness - Value(advisorCount)*w.KingWeaknessAdvisor - Value(bishopCount)*w.KingWeaknessBishop
+		if weakness < w.KingWeaknessMin {
+			weakness = w.KingWeaknessMin
 		}
 		enemyPressure := Value(0)
 		undefended := Value(0)
@@ -571,10 +390,10 @@ func (pos *PositionNG) addKingSafetyTerms(mgScore, egScore *[COLOR_NB]Value, occ
 				undefended++
 			}
 		}
-		mgScore[c] -= enemyPressure * weakness / 5
-		egScore[c] -= enemyPressure * (weakness + 2) / 8
-		mgScore[c] -= undefended * 12
-		egScore[c] -= undefended * 6
+		mgScore[c] -= enemyPressure * weakness / w.KingPressureDiv.MG
+		egScore[c] -= enemyPressure * (weakness + w.KingPressureEGBase) / w.KingPressureDiv.EG
+		mgScore[c] -= undefended * w.KingUndefended.MG
+		egScore[c] -= undefended * w.KingUndefended.EG
 
 		oppRookBB := pos.Pieces(opp, ROOK)
 		for oppRookBB.IsNotZero() {
@@ -584,11 +403,11 @@ func (pos *PositionNG) addKingSafetyTerms(mgScore, egScore *[COLOR_NB]Value, occ
 			}
 			between := BetweenBB[rSq][kingSq].And(occupied).PopCount()
 			if between == 0 {
-				mgScore[c] -= 48
-				egScore[c] -= 26
+				mgScore[c] -= w.RookFacingKing.MG
+				egScore[c] -= w.RookFacingKing.EG
 			} else if between == 1 {
-				mgScore[c] -= 18
-				egScore[c] -= 10
+				mgScore[c] -= w.RookScreeningKing.MG
+				egScore[c] -= w.RookScreeningKing.EG
 			}
 		}
 
@@ -600,16 +419,18 @@ func (pos *PositionNG) addKingSafetyTerms(mgScore, egScore *[COLOR_NB]Value, occ
 			}
 			between := BetweenBB[rSq][kingSq].And(occupied).PopCount()
 			if between == 1 {
-				mgScore[c] -= 34
-				egScore[c] -= 14
+				mgScore[c] -= w.CannonFacingKing.MG
+				egScore[c] -= w.CannonFacingKing.EG
 			} else if between == 2 {
-				mgScore[c] -= 10
+				mgScore[c] -= w.CannonScreeningKing.MG
+				egScore[c] -= w.CannonScreeningKing.EG
 			}
 		}
 	}
 }
 
 func (pos *PositionNG) addThreatTerms(mgScore, egScore *[COLOR_NB]Value, occupied Bitboard) {
+	w := pos.weights()
 	for c := Color(WHITE); c < COLOR_NB; c++ {
 		opp := notColor(c)
 		enemy := pos.Pieces(opp)
@@ -628,25 +449,30 @@ func (pos *PositionNG) addThreatTerms(mgScore, egScore *[COLOR_NB]Value, occupie
 			cheapest := leastAttackerValue(pos, attackers)
 
 			if !defenders.IsNotZero() {
-				mgScore[c] += victimValue / 7
-				egScore[c] += victimValue / 9
+				mgScore[c] += victimValue / w.ThreatHangingDiv.MG
+				egScore[c] += victimValue / w.ThreatHangingDiv.EG
 				continue
 			}
 			attackCount := Value(attackers.PopCount())
 			defendCount := Value(defenders.PopCount())
 			if cheapest > 0 && cheapest < victimValue {
 				gain := victimValue - cheapest
-				mgScore[c] += gain/10 + attackCount*4
-				egScore[c] += gain/12 + attackCount*3
+				mgScore[c] += gain/w.ThreatGainDiv.MG + attackCount*w.ThreatAttacker.MG
+				egScore[c] += gain/w.ThreatGainDiv.EG + attackCount*w.ThreatAttacker.EG
 			}
 			if attackCount > defendCount {
-				mgScore[c] += victimValue / 14
-				egScore[c] += victimValue / 16
+				mgScore[c] += victimValue / w.ThreatOutnumberDiv.MG
+				egScore[c] += victimValue / w.ThreatOutnumberDiv.EG
 			}
 		}
 	}
 }
 
+// taper interpolates between the midgame and endgame scores by phase.
+func (w *evalWeights) taper(phase int, mg, eg Value) Value {
+	return (mg*Value(phase) + eg*Value(w.totalPhase-phase)) / Value(w.totalPhase)
+}
+
 func (pos *PositionNG) evaluateWithBase(phase int, mgBase, egBase [COLOR_NB]Value) Value {
 	mgScore := mgBase
 	egScore := egBase
@@ -659,8 +485,8 @@ func (pos *PositionNG) evaluateWithBase(phase int, mgBase, egBase [COLOR_NB]Valu
 
 	mg := mgScore[WHITE] - mgScore[BLACK]
 	eg := egScore[WHITE] - egScore[BLACK]
-	score := (mg*Value(phase) + eg*Value(TotalPhase-phase)) / Value(TotalPhase)
-	score += 3
+	w := pos.weights()
+	score := pos.scaleEndgame(w.taper(phase, mg, eg)) + w.Tempo
 	if pos.SideToMove == BLACK {
 		score = -score
 	}
@@ -45,6 +45,30 @@ func TestEvaluateMatchesRecomputedStateAcrossMoves(t *testing.T) {
 	}
 }
 
+// The material, phase and piece-square sums kept up by king moves must
+// equal those of the same position set up from scratch, kings included.
+func TestKingMovesKeepIncrementalSums(t *testing.T) {
+	var pos PositionNG
+	pos.Set(initialFen)
+	var states [2]StateInfo
+	for i, mv := range []MoveNG{
+		MakeMove(SQ_E0, SQ_E1),
+		MakeMove(SQ_E9, SQ_E8),
+	} {
+		pos.DoMove(mv, &states[i])
+		var fresh PositionNG
+		if err := fresh.Set(pos.FEN()); err != nil {
+			t.Fatal(err)
+		}
+		got, want := pos.St.Top(), fresh.St.Top()
+		if got.PST != want.PST || got.Material != want.Material || got.MaterialEG != want.MaterialEG || got.Phase != want.Phase {
+			t.Errorf("after %s: sums %v %v %v %d, set up %v %v %v %d", Move2Str(mv),
+				got.PST, got.Material, got.MaterialEG, got.Phase,
+				want.PST, want.Material, want.MaterialEG, want.Phase)
+		}
+	}
+}
+
 func TestEvaluateRewardsAdvancedPawnPressure(t *testing.T) {
 	var advanced PositionNG
 	advanced.Set("4k4/9/9/4P4/9/9/9/9/9/5K3 w - - 0 1")
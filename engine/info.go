@@ -0,0 +1,103 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// InfoKind tells which fields of an Info are meaningful.
+type InfoKind uint8
+
+const (
+	// InfoIteration reports a finished line of an iteration: depth, score
+	// and PV together with the search statistics.
+	InfoIteration InfoKind = iota
+	// InfoCurrMove reports the root move being searched.
+	InfoCurrMove
+	// InfoStatus is a periodic report of the search statistics alone.
+	InfoStatus
+)
+
+// currMoveDelay is how long the search runs before it starts reporting the
+// root move it is searching; earlier reports would only flood the GUI.
+const currMoveDelay = 3 * time.Second
+
+// statusInterval is the period of the InfoStatus reports.
+const statusInterval = time.Second
+
+// Info is one progress report of a running search.
+type Info struct {
+	Kind InfoKind
+
+	Depth    int
+	SelDepth int
+	MultiPV  int // rank of the line, 0 unless several lines are searched
+	Score    Value
+	PV       []MoveNG
+
+	CurrMove       MoveNG
+	CurrMoveNumber int
+
+	Nodes    int
+	Time     time.Duration
+	HashFull int // permille of the hash table used by the current search
+}
+
+// NPS returns the nodes searched per second.
+func (i Info) NPS() int {
+	ms := i.Time.Milliseconds()
+	if ms <= 0 {
+		return 0
+	}
+	return int(int64(i.Nodes) * 1000 / ms)
+}
+
+// String formats the report as an "info" line of the UCCI and UCI protocols.
+func (i Info) String() string {
+	var sb strings.Builder
+	sb.WriteString("info")
+	switch i.Kind {
+	case InfoIteration:
+		fmt.Fprintf(&sb, " depth %d seldepth %d", i.Depth, i.SelDepth)
+		if i.MultiPV > 0 {
+			fmt.Fprintf(&sb, " multipv %d", i.MultiPV)
+		}
+		fmt.Fprintf(&sb, " score %s", scoreString(i.Score))
+		i.writeStats(&sb)
+		sb.WriteString(" pv")
+		for _, m := range i.PV {
+			fmt.Fprintf(&sb, " %s", Move2Str(m))
+		}
+	case InfoCurrMove:
+		fmt.Fprintf(&sb, " depth %d currmove %s currmovenumber %d",
+			i.Depth, Move2Str(i.CurrMove), i.CurrMoveNumber)
+	case InfoStatus:
+		i.writeStats(&sb)
+	}
+	return sb.String()
+}
+
+func (i Info) writeStats(sb *strings.Builder) {
+	fmt.Fprintf(sb, " nodes %d nps %d hashfull %d time %d",
+		i.Nodes, i.NPS(), i.HashFull, i.Time.Milliseconds())
+}
+
+// scoreString formats a score as "cp <x>", or as "mate <n>" with n the
+// number of moves (not plies) to mate, negative when being mated.
+func scoreString(v Value) string {
+	switch {
+	case v >= VALUE_MATE_IN_MAX_PLY:
+		return fmt.Sprintf("mate %d", (VALUE_MATE-v+1)/2)
+	case v <= VALUE_MATED_IN_MAX_PLY:
+		return fmt.Sprintf("mate %d", -(VALUE_MATE+v)/2)
+	}
+	return fmt.Sprintf("cp %d", v)
+}
+
+// printInfo is the reporter of new searchers: it writes each report to
+// standard output.
+func printInfo(i Info) {
+	fmt.Fprintln(os.Stdout, i)
+}
@@ -0,0 +1,84 @@
+package engine
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScoreStringConvertsMateToMoves(t *testing.T) {
+	cases := []struct {
+		v    Value
+		want string
+	}{
+		{0, "cp 0"},
+		{-150, "cp -150"},
+		{VALUE_MATE - 1, "mate 1"},
+		{VALUE_MATE - 2, "mate 1"},
+		{VALUE_MATE - 3, "mate 2"},
+		{-VALUE_MATE + 2, "mate -1"},
+		{-VALUE_MATE + 4, "mate -2"},
+	}
+	for _, c := range cases {
+		if got := scoreString(c.v); got != c.want {
+			t.Errorf("scoreString(%d) = %q, want %q", c.v, got, c.want)
+		}
+	}
+}
+
+func TestInfoString(t *testing.T) {
+	var pos PositionNG
+	if err := pos.Set(initialFen); err != nil {
+		t.Fatal(err)
+	}
+	m1, _ := ParseUCIMove(&pos, "h2e2")
+	var st StateInfo
+	pos.DoMove(m1, &st)
+	m2, _ := ParseUCIMove(&pos, "h9g7")
+	cases := []struct {
+		info Info
+		want string
+	}{
+		{
+			Info{Kind: InfoIteration, Depth: 5, SelDepth: 9, MultiPV: 2, Score: 31, PV: []MoveNG{m1, m2},
+				Nodes: 20000, Time: 500 * time.Millisecond, HashFull: 12},
+			"info depth 5 seldepth 9 multipv 2 score cp 31 nodes 20000 nps 40000 hashfull 12 time 500 pv h2e2 h9g7",
+		},
+		{
+			Info{Kind: InfoCurrMove, Depth: 12, CurrMove: m1, CurrMoveNumber: 3},
+			"info depth 12 currmove h2e2 currmovenumber 3",
+		},
+		{
+			Info{Kind: InfoStatus, Nodes: 1000, Time: 2 * time.Second},
+			"info nodes 1000 nps 500 hashfull 0 time 2000",
+		},
+	}
+	for _, c := range cases {
+		if got := c.info.String(); got != c.want {
+			t.Errorf("got  %q\nwant %q", got, c.want)
+		}
+	}
+}
+
+func TestSearcherReportsIterations(t *testing.T) {
+	var pos PositionNG
+	if err := pos.Set(initialFen); err != nil {
+		t.Fatal(err)
+	}
+	s := NewSearcher()
+	var got []Info
+	s.SetReporter(func(i Info) { got = append(got, i) })
+	s.Search(&pos, SearchLimits{Depth: 3})
+	depth := 0
+	for _, i := range got {
+		if i.Kind != InfoIteration {
+			continue
+		}
+		depth++
+		if i.Depth != depth || len(i.PV) == 0 || i.SelDepth < i.Depth {
+			t.Errorf("bad iteration report %v", i)
+		}
+	}
+	if depth != 3 {
+		t.Errorf("got %d iteration reports, want 3", depth)
+	}
+}
@@ -101,7 +101,8 @@ func EvaluateNoisyMoves(mp *MovePicker, pos *PositionNG) {
 		}
 
 		seeScore := pos.SEE(move)
-		score := PieceValue[MG][toPiece]*16 - PieceValue[MG][fromPiece]/8 + seeScore*4
+		pieceValue := &pos.weights().pieceValue
+		score := pieceValue[MG][toPiece]*16 - pieceValue[MG][fromPiece]/8 + seeScore*4
 		if seeScore < 0 {
 			score += seeScore * 8
 		}
@@ -0,0 +1,63 @@
+package engine
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestFENRoundTripKnownPositions(t *testing.T) {
+	fens := []string{
+		initialFen,
+		"rnbakabnr/9/1c5c1/p1p1p1p1p/9/9/P1P1P1P1P/1C2C4/9/RNBAKABNR b - - 1 1",
+		"2bakab2/4n4/3c1r3/p1p1p1p1p/2n6/3R5/P1P1P1P1P/2N1C4/4A4/2BAK4 w - - 12 23",
+		"4k4/3R5/9/4P4/9/9/9/5K3/9/9 w - - 0 61",
+	}
+	for _, fen := range fens {
+		var pos PositionNG
+		if err := pos.Set(fen); err != nil {
+			t.Fatalf("set %q: %v", fen, err)
+		}
+		if got := pos.FEN(); got != fen {
+			t.Errorf("FEN() = %q, want %q", got, fen)
+		}
+	}
+}
+
+// TestFENRoundTripRandomGames plays random legal games and checks that every
+// position reached survives FEN() followed by Set unchanged.
+func TestFENRoundTripRandomGames(t *testing.T) {
+	r := rand.New(rand.NewSource(20240601))
+	for game := 0; game < 20; game++ {
+		var pos PositionNG
+		if err := pos.Set(initialFen); err != nil {
+			t.Fatal(err)
+		}
+		states := make([]StateInfo, 200)
+		for ply := 0; ply < len(states); ply++ {
+			fen := pos.FEN()
+			var copied PositionNG
+			if err := copied.Set(fen); err != nil {
+				t.Fatalf("game %d ply %d: set %q: %v", game, ply, fen, err)
+			}
+			if got := copied.FEN(); got != fen {
+				t.Fatalf("game %d ply %d: round trip %q -> %q", game, ply, fen, got)
+			}
+			if copied.Board != pos.Board || copied.SideToMove != pos.SideToMove {
+				t.Fatalf("game %d ply %d: board mismatch for %q", game, ply, fen)
+			}
+			if copied.Key() != pos.Key() {
+				t.Fatalf("game %d ply %d: key mismatch for %q", game, ply, fen)
+			}
+			if copied.St.Top().Rule60 != pos.St.Top().Rule60 {
+				t.Fatalf("game %d ply %d: rule60 mismatch for %q", game, ply, fen)
+			}
+
+			var moves [MAX_MOVES]MoveNG
+			size := pos.GenerateLEGAL(moves[:])
+			if size == 0 {
+				break
+			}
+			pos.DoMove(moves[r.Intn(int(size))], &states[ply])
+		}
+	}
+}
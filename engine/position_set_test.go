@@ -1,6 +1,9 @@
 package engine
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 const initialFen = "rnbakabnr/9/1c5c1/p1p1p1p1p/9/9/P1P1P1P1P/1C5C1/9/RNBAKABNR w - - 0 1"
 
@@ -35,3 +38,70 @@ func TestPositionSetResetsState(t *testing.T) {
 		t.Fatalf("move should be legal after reset: %v", err)
 	}
 }
+
+// badFens pairs FENs that Set must reject with a part of their error.
+var badFens = []struct {
+	fen, err string
+}{
+	{"", "need piece placement and side to move"},
+	{"rnbakabnr/9/1c5c1/p1p1p1p1p/9/9/P1P1P1P1P/1C5C1/9/RNBAKABNR", "need piece placement and side to move"},
+	{"rnbakabnr/9/1c5c1/p1p1p1p1p/9/P1P1P1P1P/1C5C1/9/RNBAKABNR w", "9 ranks, want 10"},
+	{"rnbakabnr/9/1c5c1/p1p1p1p1p/9/9/P1P1P1P1P/1C5C1/9/RNBAKABNR/9 w", "11 ranks, want 10"},
+	{"rnbakabnr/9/1c5c1/p1p1p1p1p/9/9/P1P1P1P1P/1C5C1/9/RNBAKABNX w", "bad token 'X'"},
+	{"rnbakabnr/9/1c5c1/p1p1p1p1p/9/9/P1P1P1P1P/1C5C1/9/RNBAKABN- w", "bad token '-'"},
+	{"rnbakabnr1/9/1c5c1/p1p1p1p1p/9/9/P1P1P1P1P/1C5C1/9/RNBAKABNR w", "rank 9 has 10 files"},
+	{"rnbakabn/9/1c5c1/p1p1p1p1p/9/9/P1P1P1P1P/1C5C1/9/RNBAKABNR w", "rank 9 has 8 files"},
+	{"rnbakabnr/9/1c5c1/p1p1p1p1p/9/9/P1P1P1P1P/1C5C1/9/RNBAKAB9 w", "rank 0 has 16 files"},
+	{"rnbakabnr/9/1c5c1/p1p1p1p1p/9/9/P1P1P1P1P/1C5C1/9/RNBAKABNR x", `bad side to move "x"`},
+	{"rnbakabnr/9/1c5c1/p1p1p1p1p/9/9/P1P1P1P1P/1C5C1/9/RNBAKABNR w - - -1 1", `bad halfmove clock "-1"`},
+	{"rnbakabnr/9/1c5c1/p1p1p1p1p/9/9/P1P1P1P1P/1C5C1/9/RNBAKABNR w - - 0 z", `bad fullmove number "z"`},
+	{"4k4/9/9/9/9/9/9/9/R1R1R4/3K5 w", "too many R: 3"},
+	{"3aka3/4a4/9/9/9/9/9/9/9/3K5 w", "too many a: 3"},
+	{"4k4/9/9/9/9/9/9/9/9/A2K5 w", "A cannot stand on a0"},
+	{"4k4/9/9/9/9/9/9/9/9/B2K5 w", "B cannot stand on a0"},
+	{"4k4/9/9/9/9/9/9/9/9/K8 w", "K cannot stand on a0"},
+	{"4k4/9/9/9/9/9/9/9/9/P2K5 w", "P cannot stand on a0"},
+	{"4k4/9/9/9/9/9/9/9/9/9 w", "side 0 has 0 kings"},
+	{"3kk4/9/9/9/9/9/9/9/9/5K3 w", "side 1 has 2 kings"},
+	{"4k4/9/9/9/9/9/9/9/9/4K4 w", "kings are facing each other"},
+}
+
+func TestPositionSetRejectsBadFen(t *testing.T) {
+	for _, c := range badFens {
+		var pos PositionNG
+		err := pos.Set(c.fen)
+		if err == nil {
+			t.Errorf("%q: accepted", c.fen)
+		} else if !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%q: error %q, want %q", c.fen, err, c.err)
+		}
+	}
+}
+
+func TestPositionSetKeepsPositionOnError(t *testing.T) {
+	var pos PositionNG
+	if err := pos.Set(initialFen); err != nil {
+		t.Fatal(err)
+	}
+	m, err := ParseUCIMove(&pos, "h2e2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var st StateInfo
+	pos.DoMove(m, &st)
+	board, key := pos.String(), pos.Key()
+	for _, c := range badFens {
+		if err := pos.Set(c.fen); err == nil {
+			t.Fatalf("%q: accepted", c.fen)
+		}
+		if pos.String() != board || pos.Key() != key {
+			t.Fatalf("%q: position changed to\n%s", c.fen, &pos)
+		}
+		if !pos.PosIsOk() {
+			t.Fatalf("%q: position invalid after a rejected Set", c.fen)
+		}
+	}
+	if _, err := ParseUCIMove(&pos, "h9g7"); err != nil {
+		t.Errorf("move should still be legal: %v", err)
+	}
+}
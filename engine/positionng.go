@@ -2,11 +2,8 @@ package engine
 
 import (
 	"fmt"
-	"log"
-	"math/rand"
 	"strconv"
 	"strings"
-	"time"
 	"unicode"
 )
 
@@ -30,16 +27,33 @@ type Zobrist struct {
 
 var zkey Zobrist
 
+// zobristSeed seeds the generator of the Zobrist keys. The keys, and so
+// every hash key, depend on it; saved hash tables record it.
+const zobristSeed = 1070372
+
+// prng is the xorshift64* generator of Stockfish's misc.h (Vigna, "An
+// experimental exploration of Marsaglia's xorshift generators, scrambled").
+// The Zobrist keys are its first outputs from zobristSeed: psq[pc][s] for
+// every piece pc and square s in increasing order, then side. Changing the
+// generator, the seed or the order changes every hash key, which breaks
+// opening books, saved hash tables and the golden keys in the tests.
+type prng struct{ s uint64 }
+
+func (r *prng) next() uint64 {
+	r.s ^= r.s >> 12
+	r.s ^= r.s << 25
+	r.s ^= r.s >> 27
+	return r.s * 2685821657736338717
+}
+
 func init() {
-	now := time.Now()
-	r := rand.New(rand.NewSource(1070372))
+	r := prng{zobristSeed}
 	for pc := 0; pc < PIECE_NB; pc++ {
 		for s := SQ_A0; s <= SQ_I9; s++ {
-			zkey.psq[pc][s] = r.Uint64()
+			zkey.psq[pc][s] = r.next()
 		}
 	}
-	zkey.side = r.Uint64()
-	log.Printf("zkey init cast time: %v\n", time.Since(now))
+	zkey.side = r.next()
 }
 
 // / StateInfo struct stores information needed to restore a Position object to
@@ -96,6 +110,13 @@ type PositionNG struct {
 	SideToMove Color
 	GamePly    int
 	Nodes      int
+	// rootPly counts the game plies before GamePly, which a search
+	// restarts from 0 at its root.
+	rootPly int
+
+	// eval holds the evaluation weights of the position, taken by SetState
+	// from those set by SetEvalParams.
+	eval *evalWeights
 
 	// Bloom filter for fast repetition filtering
 	Filter BloomFilter
@@ -174,6 +195,12 @@ func (p *PositionNG) Checkers() Bitboard {
 	return p.St.Top().checkersBB
 }
 
+// Key returns the Zobrist hash key of the position. It depends only on the
+// piece placement and the side to move, and is the same in every run.
+func (p *PositionNG) Key() Key {
+	return p.St.Top().key
+}
+
 // / Position::checkers_to() computes a bitboard of all pieces of a given color
 // / which gives check to a given square. Slider attacks use the occupied bitboard
 // / to indicate occupancy.
@@ -519,40 +546,42 @@ func (pos *PositionNG) GenerateLEGAL(movieList []MoveNG) (size uint8) {
 }
 
 // / Position::pos_is_ok() performs some consistency checks for the
-// / position object and raises an asserts if something wrong is detected.
-// / This is meant to be helpful when debugging.
+// / position object. This is meant to be helpful when debugging.
 func (pos *PositionNG) PosIsOk() bool {
-	if (pos.SideToMove != WHITE && pos.SideToMove != BLACK) ||
-		pos.PieceOn(pos.Square(KING, WHITE)) != W_KING ||
-		pos.PieceOn(pos.Square(KING, BLACK)) != B_KING {
-		fmt.Println("pos_is_ok: Default")
-		return false
+	return pos.Validate() == nil
+}
+
+// Validate returns an error describing the first inconsistency found in the
+// position, or nil if it is sound.
+func (pos *PositionNG) Validate() error {
+	if pos.SideToMove != WHITE && pos.SideToMove != BLACK {
+		return fmt.Errorf("pos_is_ok: bad side to move %d", pos.SideToMove)
 	}
 	if pos.PieceCount[W_KING] != 1 ||
 		pos.PieceCount[B_KING] != 1 ||
-		pos.CheckersTo2(pos.SideToMove, pos.Square(KING, notColor(pos.SideToMove))) != (Bitboard{}) {
-		fmt.Println("pos_is_ok: Kings")
-		return false
+		pos.PieceOn(pos.Square(KING, WHITE)) != W_KING ||
+		pos.PieceOn(pos.Square(KING, BLACK)) != B_KING {
+		return fmt.Errorf("pos_is_ok: kings")
+	}
+	if pos.CheckersTo2(pos.SideToMove, pos.Square(KING, notColor(pos.SideToMove))) != (Bitboard{}) {
+		return fmt.Errorf("pos_is_ok: side not to move is in check")
 	}
 	if pos.Pieces(WHITE, PAWN).And(PawnBB[WHITE].Not()).IsNotZero() ||
 		pos.Pieces(BLACK, PAWN).And(PawnBB[BLACK].Not()).IsNotZero() ||
 		pos.PieceCount[W_PAWN] > 5 ||
 		pos.PieceCount[B_PAWN] > 5 {
-		fmt.Println("pos_is_ok: Pawns")
-		return false
+		return fmt.Errorf("pos_is_ok: pawns")
 	}
 	if pos.Pieces(WHITE).And(pos.Pieces(BLACK)).IsNotZero() ||
 		pos.Pieces(WHITE).Or(pos.Pieces(BLACK)) != pos.PiecesAllColor(ALL_PIECES) ||
 		pos.Pieces(WHITE).PopCount() > 16 ||
 		pos.Pieces(BLACK).PopCount() > 16 {
-		fmt.Println("pos_is_ok: Bitboards")
-		return false
+		return fmt.Errorf("pos_is_ok: bitboards")
 	}
 	for p1 := PAWN; p1 <= KING; p1++ {
 		for p2 := PAWN; p2 <= KING; p2++ {
 			if p1 != p2 && pos.PiecesAllColor(p1).And(pos.PiecesAllColor(p2)).IsNotZero() {
-				fmt.Println("pos_is_ok: Bitboards")
-				return false
+				return fmt.Errorf("pos_is_ok: bitboards")
 			}
 		}
 	}
@@ -564,12 +593,16 @@ func (pos *PositionNG) PosIsOk() bool {
 	for _, pc := range pieces {
 		if pos.PieceCount[pc] != int(pos.Pieces(ColorOf(pc), TypeOf(pc)).PopCount()) ||
 			pos.PieceCount[pc] != Count(pos.Board[:], pc) {
-			fmt.Printf("pos_is_ok: Pieces[%v]\n", pc)
-			return false
+			return fmt.Errorf("pos_is_ok: pieces[%v]", pc)
 		}
 	}
 
-	return true
+	return nil
+}
+
+// pieceChar returns the FEN letter of a piece.
+func pieceChar(pc Piece) byte {
+	return " RACPNBK racpnbk"[pc]
 }
 
 func parsePiece(ch rune) Piece {
@@ -667,6 +700,7 @@ func (pos *PositionNG) doMove(m MoveNG, newSt *StateInfo, givesCheck bool) {
 	captured := pos.PieceOn(to)
 	pcPSTIdx := pstIndex(pc, from)
 	toPSTIdx := pstIndex(pc, to)
+	w := pos.weights()
 
 	//   assert(color_of(pc) == us);
 	//   assert(captured == NO_PIECE || color_of(captured) == them);
@@ -674,12 +708,12 @@ func (pos *PositionNG) doMove(m MoveNG, newSt *StateInfo, givesCheck bool) {
 
 	if captured != NO_PIECE {
 		capsq := to
-		st.Material[them] -= PieceValue[MG][captured]
-		st.MaterialEG[them] -= PieceValue[EG][captured]
+		st.Material[them] -= w.pieceValue[MG][captured]
+		st.MaterialEG[them] -= w.pieceValue[EG][captured]
 		capturedPSTIdx := pstIndex(captured, capsq)
-		st.PST[MG][them] -= pstMG[TypeOf(captured)][capturedPSTIdx]
-		st.PST[EG][them] -= pstEG[TypeOf(captured)][capturedPSTIdx]
-		st.Phase -= phaseContribution(TypeOf(captured))
+		st.PST[MG][them] -= w.PSTMG[TypeOf(captured)][capturedPSTIdx]
+		st.PST[EG][them] -= w.PSTEG[TypeOf(captured)][capturedPSTIdx]
+		st.Phase -= w.Phase[TypeOf(captured)]
 
 		// Update board and piece lists
 		pos.RemovePiece(capsq)
@@ -694,8 +728,8 @@ func (pos *PositionNG) doMove(m MoveNG, newSt *StateInfo, givesCheck bool) {
 	}
 	// Update hash key
 	k ^= zkey.psq[pc][from] ^ zkey.psq[pc][to]
-	st.PST[MG][us] += pstMG[TypeOf(pc)][toPSTIdx] - pstMG[TypeOf(pc)][pcPSTIdx]
-	st.PST[EG][us] += pstEG[TypeOf(pc)][toPSTIdx] - pstEG[TypeOf(pc)][pcPSTIdx]
+	st.PST[MG][us] += w.PSTMG[TypeOf(pc)][toPSTIdx] - w.PSTMG[TypeOf(pc)][pcPSTIdx]
+	st.PST[EG][us] += w.PSTEG[TypeOf(pc)][toPSTIdx] - w.PSTEG[TypeOf(pc)][pcPSTIdx]
 
 	pos.MovePiece(from, to)
 
@@ -820,66 +854,243 @@ func (pos *PositionNG) resetToEmpty() {
 	pos.Filter.Reset()
 	pos.SideToMove = WHITE
 	pos.GamePly = 0
+	pos.rootPly = 0
 	pos.Nodes = 0
 	pos.St = nil
 }
 
-// / Position::set() initializes the position object with the given FEN string.
-// / This function is not very robust - make sure that input FENs are correct,
-// / this is assumed to be the responsibility of the GUI.
-func (pos *PositionNG) Set(fenStr string) *PositionNG {
-	pos.resetToEmpty()
-	st := new(StateInfo)
-	pos.St = NewStateInfoStack()
-	pos.St.Push(st)
-	sq := SQ_A9
+// copyTo makes dst an independent copy of pos, state stack included, so
+// that it can be searched by another goroutine.
+func (pos *PositionNG) copyTo(dst *PositionNG) {
+	*dst = *pos
+	states := make([]StateInfo, len(pos.St))
+	dst.St = make(StateInfoStack, len(pos.St), len(pos.St)+int(MAX_PLY))
+	for i, st := range pos.St {
+		states[i] = *st
+		dst.St[i] = &states[i]
+	}
+}
 
-	tokens := strings.Split(fenStr, " ")
+// / Position::set() initializes the position object with the given FEN string.
+// / The FEN is validated before the position is touched, so on error the
+// / position keeps its previous state.
+func (pos *PositionNG) Set(fenStr string) error {
+	tokens := strings.Fields(fenStr)
 	if len(tokens) < 2 {
-		log.Fatalf("bad fen: %s", fenStr)
+		return fmt.Errorf("bad fen %q: need piece placement and side to move", fenStr)
 	}
+
 	// 1. Piece placement
-	for _, token := range tokens[0] {
-		if unicode.IsDigit(token) {
-			sq += (int(token) - '0') * EAST
-		} else if token == '/' {
-			sq += 2 * SOUTH
-		} else if pc := parsePiece(token); pc > 0 {
-			pos.PutPiece(pc, sq)
-			sq++
-		} else {
-			fmt.Printf("bad token: %v\n", string(token))
-			sq++
+	var board [SQUARE_NB]Piece
+	ranks := strings.Split(tokens[0], "/")
+	if len(ranks) != int(RANK_NB) {
+		return fmt.Errorf("bad fen %q: %d ranks, want %d", fenStr, len(ranks), RANK_NB)
+	}
+	for i, rankStr := range ranks {
+		r := RANK_9 - Rank(i)
+		f := FILE_A
+		for _, token := range rankStr {
+			if unicode.IsDigit(token) {
+				f += int(token - '0')
+			} else if pc := parsePiece(token); pc != NO_PIECE {
+				if f < FILE_NB {
+					board[MakeSquareNG(f, r)] = pc
+				}
+				f++
+			} else {
+				return fmt.Errorf("bad fen %q: bad token %q", fenStr, token)
+			}
+			if f > FILE_NB {
+				break
+			}
+		}
+		if f != FILE_NB {
+			return fmt.Errorf("bad fen %q: rank %d has %d files", fenStr, r, f)
 		}
 	}
+
 	// 2. Active color
-	if tokens[1] == "w" {
-		pos.SideToMove = WHITE
-	} else {
-		pos.SideToMove = BLACK
+	var sideToMove Color
+	switch tokens[1] {
+	case "w", "r":
+		sideToMove = WHITE
+	case "b":
+		sideToMove = BLACK
+	default:
+		return fmt.Errorf("bad fen %q: bad side to move %q", fenStr, tokens[1])
 	}
 
+	// 3-4. Castling and en passant fields are unused in xiangqi.
+	// 5-6. Halfmove clock and fullmove number
+	rule60, fullmove := 0, 1
+	var err error
 	if len(tokens) >= 5 {
-		st.Rule60, _ = strconv.Atoi(tokens[4])
+		if rule60, err = strconv.Atoi(tokens[4]); err != nil || rule60 < 0 {
+			return fmt.Errorf("bad fen %q: bad halfmove clock %q", fenStr, tokens[4])
+		}
 	}
 	if len(tokens) >= 6 {
-		pos.GamePly, _ = strconv.Atoi(tokens[5])
+		if fullmove, err = strconv.Atoi(tokens[5]); err != nil || fullmove < 0 {
+			return fmt.Errorf("bad fen %q: bad fullmove number %q", fenStr, tokens[5])
+		}
+	}
+
+	if err := validateBoard(&board, sideToMove); err != nil {
+		return fmt.Errorf("bad fen %q: %w", fenStr, err)
+	}
+
+	// Build the position aside so a failed check leaves pos untouched.
+	var next PositionNG
+	next.resetToEmpty()
+	st := new(StateInfo)
+	next.St = NewStateInfoStack()
+	next.St.Push(st)
+	for sq, pc := range board {
+		if pc != NO_PIECE {
+			next.PutPiece(pc, sq)
+		}
 	}
+	next.SideToMove = sideToMove
+	st.Rule60 = rule60
 	// Convert from fullmove starting from 1 to gamePly starting from 0,
 	// handle also common incorrect FEN with fullmove = 0.
-	pos.GamePly = max(2*(pos.GamePly-1), 0)
-	if pos.SideToMove == BLACK {
-		pos.GamePly += 1
+	next.GamePly = max(2*(fullmove-1), 0)
+	if next.SideToMove == BLACK {
+		next.GamePly += 1
+	}
+	next.KingSQ[WHITE] = next.Square(KING, WHITE)
+	next.KingSQ[BLACK] = next.Square(KING, BLACK)
+
+	next.SetState()
+
+	if err := next.Validate(); err != nil {
+		return fmt.Errorf("bad fen %q: %w", fenStr, err)
+	}
+	*pos = next
+	return nil
+}
+
+// FEN returns the FEN string of the position, including side to move, the
+// Rule60 counter and the fullmove number. It round-trips through Set.
+func (pos *PositionNG) FEN() string {
+	var sb strings.Builder
+	for r := RANK_9; r >= RANK_0; r-- {
+		empty := 0
+		for f := FILE_A; f <= FILE_I; f++ {
+			pc := pos.Board[MakeSquareNG(f, r)]
+			if pc == NO_PIECE {
+				empty++
+				continue
+			}
+			if empty > 0 {
+				sb.WriteByte(byte('0' + empty))
+				empty = 0
+			}
+			sb.WriteByte(pieceChar(pc))
+		}
+		if empty > 0 {
+			sb.WriteByte(byte('0' + empty))
+		}
+		if r > RANK_0 {
+			sb.WriteByte('/')
+		}
+	}
+	if pos.SideToMove == WHITE {
+		sb.WriteString(" w")
+	} else {
+		sb.WriteString(" b")
+	}
+	rule60 := 0
+	if len(pos.St) > 0 {
+		rule60 = max(pos.St.Top().Rule60, 0)
+	}
+	fmt.Fprintf(&sb, " - - %d %d", rule60, (pos.rootPly+pos.GamePly)/2+1)
+	return sb.String()
+}
+
+// maxPieceCount is the number of pieces of each type a side starts with.
+var maxPieceCount = [PIECE_TYPE_NB]int{
+	ROOK:    2,
+	ADVISOR: 2,
+	CANNON:  2,
+	PAWN:    5,
+	KNIGHT:  2,
+	BISHOP:  2,
+	KING:    1,
+}
+
+// legalSquares returns the squares a piece of the given kind may ever stand
+// on: kings and advisors stay in their palace, bishops in their own half on
+// the bishop points, and pawns never move backwards.
+func legalSquares(pc Piece) Bitboard {
+	c := ColorOf(pc)
+	switch TypeOf(pc) {
+	case KING:
+		return Palace.And(HalfBB[c])
+	case ADVISOR:
+		return relativeSquares(c, SQ_D0, SQ_F0, SQ_E1, SQ_D2, SQ_F2)
+	case BISHOP:
+		return relativeSquares(c, SQ_C0, SQ_G0, SQ_A2, SQ_E2, SQ_I2, SQ_C4, SQ_G4)
+	case PAWN:
+		return PawnBB[c]
+	default:
+		return HalfBB[WHITE].Or(HalfBB[BLACK])
 	}
-	pos.KingSQ[WHITE] = pos.Square(KING, WHITE)
-	pos.KingSQ[BLACK] = pos.Square(KING, BLACK)
+}
 
-	pos.SetState()
+// relativeSquares maps squares given from White's side to the side c.
+func relativeSquares(c Color, squares ...Square) Bitboard {
+	b := From64(0)
+	for _, sq := range squares {
+		if c == BLACK {
+			sq = flipSquare(sq)
+		}
+		b = b.Or(SquareBB[sq])
+	}
+	return b
+}
 
-	if !pos.PosIsOk() {
-		log.Fatalf("pos_is_ok: fen: %s", fenStr)
+// validateBoard checks that a board could arise in a game: piece counts,
+// palace and side placement, and the kings not facing each other.
+func validateBoard(board *[SQUARE_NB]Piece, sideToMove Color) error {
+	var count [PIECE_NB]int
+	var kingSq [COLOR_NB]Square
+	for sq, pc := range board {
+		if pc == NO_PIECE {
+			continue
+		}
+		count[pc]++
+		if !legalSquares(pc).And(SquareBB[sq]).IsNotZero() {
+			return fmt.Errorf("%c cannot stand on %s", pieceChar(pc), squareStr(sq))
+		}
+		if TypeOf(pc) == KING {
+			kingSq[ColorOf(pc)] = sq
+		}
+	}
+	for c := Color(WHITE); c < COLOR_NB; c++ {
+		if count[MakePieceNG(c, KING)] != 1 {
+			return fmt.Errorf("side %d has %d kings", c, count[MakePieceNG(c, KING)])
+		}
+		for pt := ROOK; pt <= BISHOP; pt++ {
+			pc := MakePieceNG(c, pt)
+			if count[pc] > maxPieceCount[pt] {
+				return fmt.Errorf("too many %c: %d", pieceChar(pc), count[pc])
+			}
+		}
+	}
+	if FileOf(kingSq[WHITE]) == FileOf(kingSq[BLACK]) {
+		facing := true
+		for sq := kingSq[WHITE] + NORTH; sq < kingSq[BLACK]; sq += NORTH {
+			if board[sq] != NO_PIECE {
+				facing = false
+				break
+			}
+		}
+		if facing {
+			return fmt.Errorf("kings are facing each other")
+		}
 	}
-	return pos
+	return nil
 }
 
 // / Position::set_check_info() sets king attacks to detect if a move gives check
@@ -905,6 +1116,8 @@ func (pos *PositionNG) SetCheckInfo() {
 // / data that once computed is updated incrementally as moves are made.
 // / The function is only used when a new position is set up
 func (pos *PositionNG) SetState() {
+	pos.eval = currentWeights.Load()
+	w := pos.eval
 	st := pos.St.Top()
 	st.key = 0
 	st.Material[WHITE] = VALUE_ZERO
@@ -921,17 +1134,17 @@ func (pos *PositionNG) SetState() {
 		s := PopLsb(&b)
 		pc := pos.PieceOn(s)
 		st.key ^= zkey.psq[pc][s]
+		idx := pstIndex(pc, s)
+		st.PST[MG][ColorOf(pc)] += w.PSTMG[TypeOf(pc)][idx]
+		st.PST[EG][ColorOf(pc)] += w.PSTEG[TypeOf(pc)][idx]
 		if TypeOf(pc) != KING {
-			st.Material[ColorOf(pc)] += PieceValue[MG][pc]
-			st.MaterialEG[ColorOf(pc)] += PieceValue[EG][pc]
-			idx := pstIndex(pc, s)
-			st.PST[MG][ColorOf(pc)] += pstMG[TypeOf(pc)][idx]
-			st.PST[EG][ColorOf(pc)] += pstEG[TypeOf(pc)][idx]
-			st.Phase += phaseContribution(TypeOf(pc))
+			st.Material[ColorOf(pc)] += w.pieceValue[MG][pc]
+			st.MaterialEG[ColorOf(pc)] += w.pieceValue[EG][pc]
+			st.Phase += w.Phase[TypeOf(pc)]
 		}
 	}
-	if st.Phase > TotalPhase {
-		st.Phase = TotalPhase
+	if st.Phase > w.totalPhase {
+		st.Phase = w.totalPhase
 	}
 	if pos.SideToMove == BLACK {
 		st.key ^= zkey.side
@@ -1,17 +1,13 @@
 package engine
 
 import (
-	"fmt"
+	"cmp"
 	"math"
-	"sync/atomic"
+	"slices"
+	"sync"
 	"time"
 )
 
-var (
-	PvTable  = [MAX_MOVES * MAX_MOVES]MoveNG{}
-	PvLength = [MAX_MOVES]int{}
-)
-
 // Pre-computed LMR reduction table: lmrTable[depth][moveCount].
 var lmrTable [64][64]int
 
@@ -25,33 +21,72 @@ func init() {
 
 // SearchLimits holds the time and depth constraints for a search.
 type SearchLimits struct {
-	Depth     uint8
-	TimeLimit time.Duration // 0 means no time limit
-	Infinite  bool
+	Depth       uint8
+	TimeLimit   time.Duration // hard limit, 0 means no time limit
+	SoftTime    time.Duration // no new iteration past this, 0 for none; see TimeControl.Budget
+	Infinite    bool
+	Ponder      bool     // TimeLimit only starts counting at PonderHit
+	BanMoves    []MoveNG // root moves that must not be played
+	SearchMoves []MoveNG // if not empty, the only root moves to search
+	MultiPV     int      // number of best lines to report, 0 or 1 for just the best
+
+	// Nodes stops the search after this many nodes. Such a search runs on
+	// one thread from an empty hash table and history, so the same position
+	// always gives the same result; the hash of earlier searches is lost.
+	Nodes int
+	// Mate looks only for a mate in at most this many moves.
+	Mate int
 }
 
-// stopFlag is set to 1 when the search should be aborted.
-var stopFlag atomic.Int32
+// analysis reports whether the search is for analysis rather than to play
+// a move, so that it must not be cut short by the book or tablebases.
+func (l SearchLimits) analysis() bool {
+	return l.Infinite || l.Ponder || l.Mate > 0 || l.MultiPV > 1
+}
 
-// StopSearch sets the flag to abort the search.
-func StopSearch() {
-	stopFlag.Store(1)
+// allowed reports whether the limits let the root move m be played.
+func (l SearchLimits) allowed(m MoveNG) bool {
+	if len(l.SearchMoves) > 0 && !slices.Contains(l.SearchMoves, m) {
+		return false
+	}
+	return !slices.Contains(l.BanMoves, m)
 }
 
-func shouldStop() bool {
-	return stopFlag.Load() != 0
+// SearchResult is the outcome of a search started with StartSearch.
+type SearchResult struct {
+	BestMove   MoveNG
+	PonderMove MoveNG // expected reply to BestMove, MOVE_NONE if unknown
+	Nodes      int    // nodes searched by all threads
+	Lines      []PVLine
 }
 
-func StorePvMove(move MoveNG, searchPly int) {
-	PvTable[searchPly*int(MAX_MOVES)+searchPly] = move
-	for nextPly := searchPly + 1; nextPly < PvLength[searchPly+1]; nextPly++ {
-		PvTable[searchPly*int(MAX_MOVES)+nextPly] = PvTable[(searchPly+1)*int(MAX_MOVES)+nextPly]
+// MaxMultiPV bounds SearchLimits.MultiPV.
+const MaxMultiPV = 64
+
+// PVLine is one ranked root move of the last completed iteration, with its
+// score and principal variation. With MultiPV the lines are best first.
+type PVLine struct {
+	Score    Value
+	Depth    uint8
+	SelDepth int // deepest ply reached while searching the line
+	Moves    []MoveNG
+}
+
+func (t *searchThread) StorePvMove(move MoveNG, searchPly int) {
+	t.pvTable[searchPly*int(MAX_MOVES)+searchPly] = move
+	for nextPly := searchPly + 1; nextPly < t.pvLength[searchPly+1]; nextPly++ {
+		t.pvTable[searchPly*int(MAX_MOVES)+nextPly] = t.pvTable[(searchPly+1)*int(MAX_MOVES)+nextPly]
 	}
-	PvLength[searchPly] = PvLength[searchPly+1]
+	t.pvLength[searchPly] = t.pvLength[searchPly+1]
 }
 
-func Quiescence(alpha, beta Value, pos *PositionNG) (bestScore Value) {
-	PvLength[pos.GamePly] = pos.GamePly
+func (t *searchThread) Quiescence(alpha, beta Value) (bestScore Value) {
+	pos := t.pos
+	t.pvLength[pos.GamePly] = pos.GamePly
+	t.selDepth = max(t.selDepth, pos.GamePly)
+	if t.outOfNodes() {
+		return 0
+	}
 	evaluation := pos.Evaluate()
 	if pos.GamePly >= int(MAX_MOVES) {
 		return evaluation
@@ -75,10 +110,13 @@ func Quiescence(alpha, beta Value, pos *PositionNG) (bestScore Value) {
 		}
 		var st StateInfo
 		pos.DoMove(currentMove, &st)
-		score := -Quiescence(-beta, -alpha, pos)
+		score := -t.Quiescence(-beta, -alpha)
 		pos.UndoMove(currentMove)
+		if t.shouldStop() {
+			return 0
+		}
 		if score > alpha {
-			StorePvMove(currentMove, pos.GamePly)
+			t.StorePvMove(currentMove, pos.GamePly)
 			alpha = score
 
 			if score >= beta {
@@ -89,15 +127,22 @@ func Quiescence(alpha, beta Value, pos *PositionNG) (bestScore Value) {
 	return alpha
 }
 
-func Negamax(alpha, beta Value, pos *PositionNG, depth uint8, doNullMove bool) (bestScore Value) {
+func (t *searchThread) Negamax(alpha, beta Value, depth uint8, doNullMove bool) (bestScore Value) {
 	MaybeYield()
-	PvLength[pos.GamePly] = pos.GamePly
+	pos := t.pos
+	t.nodes.Store(int64(pos.Nodes))
+	t.pvLength[pos.GamePly] = pos.GamePly
+	t.selDepth = max(t.selDepth, pos.GamePly)
 	rootNode := pos.GamePly == 0
 	pvNode := alpha != beta-1
 	hashFlag := TT_ALPHA
 	var score Value
 	var legalMoves int
 
+	if t.outOfNodes() {
+		return 0
+	}
+
 	// Rule60 draw
 	if pos.IsDraw() {
 		return 0
@@ -115,23 +160,38 @@ func Negamax(alpha, beta Value, pos *PositionNG, depth uint8, doNullMove bool) (
 		}
 	}
 
+	// Endgame tablebases know the outcome of small endings exactly. The
+	// piece count keeps the lookup out of the middlegame.
+	if pos.GamePly > 0 && t.s.tb != nil && int(pos.PiecesAllColor(ALL_PIECES).PopCount())-2 <= t.s.tb.maxPieces {
+		if v, ok := t.s.tb.Probe(pos); ok {
+			return v.Value(pos.GamePly)
+		}
+	}
+
 	// Check time periodically (every 4096 nodes at root level)
-	if pos.Nodes&4095 == 0 && shouldStop() {
-		return 0
+	if pos.Nodes&4095 == 0 {
+		if t.id == 0 {
+			t.s.reportStatus()
+		}
+		if t.shouldStop() {
+			return 0
+		}
 	}
 
 	var ttMove MoveNG
 	var bestMove MoveNG
 	if pos.GamePly > 0 {
 		var scoreInt16 int16
-		scoreInt16, ttMove = readHashEntry(pos.St.Top().key, int16(alpha), int16(beta), &bestMove, depth, uint8(pos.GamePly))
+		scoreInt16, ttMove = t.s.tt.readHashEntry(pos.St.Top().key, int16(alpha), int16(beta), &bestMove, depth, uint8(pos.GamePly))
 		score = int32(scoreInt16)
-		if score != int32(NO_HASH) && !pvNode {
+		// A proof cannot rest on entries stored by the pruned searches, so
+		// it only takes the move from them.
+		if score != int32(NO_HASH) && !pvNode && !t.proving {
 			return score
 		}
 	}
 	if depth == 0 {
-		return Quiescence(alpha, beta, pos)
+		return t.Quiescence(alpha, beta)
 	}
 
 	// Mate distance pruning
@@ -151,7 +211,7 @@ func Negamax(alpha, beta Value, pos *PositionNG, depth uint8, doNullMove bool) (
 	}
 
 	var staticEval Value
-	if !pvNode && !inCheck {
+	if !pvNode && !inCheck && !t.proving {
 		staticEval = pos.Evaluate()
 
 		// Razoring: if static eval + margin < alpha and depth is low, drop into QSearch
@@ -159,9 +219,9 @@ func Negamax(alpha, beta Value, pos *PositionNG, depth uint8, doNullMove bool) (
 			razoringMargin := Value(300 + 200*int(depth))
 			if staticEval+razoringMargin < alpha {
 				if depth == 1 {
-					return Quiescence(alpha, beta, pos)
+					return t.Quiescence(alpha, beta)
 				}
-				qScore := Quiescence(alpha, beta, pos)
+				qScore := t.Quiescence(alpha, beta)
 				if qScore < alpha {
 					return qScore
 				}
@@ -181,7 +241,7 @@ func Negamax(alpha, beta Value, pos *PositionNG, depth uint8, doNullMove bool) (
 			}
 			var st StateInfo
 			pos.DoNullMove(&st)
-			score = -Negamax(-beta, -beta+1, pos, depth-1-r, false)
+			score = -t.Negamax(-beta, -beta+1, depth-1-r, false)
 			pos.UndoNullMove()
 
 			if score >= beta {
@@ -192,7 +252,7 @@ func Negamax(alpha, beta Value, pos *PositionNG, depth uint8, doNullMove bool) (
 
 	// Futility pruning condition
 	futilityPruning := false
-	if !pvNode && !inCheck && depth <= 3 {
+	if !pvNode && !inCheck && !t.proving && depth <= 3 {
 		futilityMargin := Value(200 * int(depth))
 		staticEvalForFutility := staticEval
 		if staticEvalForFutility == 0 && (pvNode || inCheck) {
@@ -228,7 +288,18 @@ func Negamax(alpha, beta Value, pos *PositionNG, depth uint8, doNullMove bool) (
 		if !pos.Legal(currentMove) {
 			continue
 		}
+		if rootNode && t.isBanned(currentMove) {
+			continue
+		}
 		legalMoves++
+		if rootNode && t.id == 0 && time.Since(t.s.start) >= currMoveDelay {
+			t.s.info(Info{
+				Kind:           InfoCurrMove,
+				Depth:          int(t.rootDepth),
+				CurrMove:       currentMove,
+				CurrMoveNumber: t.pvIdx + legalMoves,
+			})
+		}
 
 		isCapture := pos.Capture(currentMove)
 		givesCheck := pos.GivesCheck(currentMove)
@@ -244,12 +315,12 @@ func Negamax(alpha, beta Value, pos *PositionNG, depth uint8, doNullMove bool) (
 		// PVS + LMR
 		if movesSearched == 0 {
 			// First move: full window search
-			score = -Negamax(-beta, -alpha, pos, depth-1, true)
+			score = -t.Negamax(-beta, -alpha, depth-1, true)
 		} else {
 			reduction := uint8(0)
 
 			// LMR: reduce depth for late quiet moves
-			if depth >= 3 && movesSearched >= 3 && !isCapture && !inCheck {
+			if depth >= 3 && movesSearched >= 3 && !isCapture && !inCheck && !t.proving {
 				d := min(int(depth), 63)
 				m := min(movesSearched, 63)
 				reduction = uint8(lmrTable[d][m])
@@ -276,16 +347,16 @@ func Negamax(alpha, beta Value, pos *PositionNG, depth uint8, doNullMove bool) (
 			}
 
 			// PVS: search with null window
-			score = -Negamax(-alpha-1, -alpha, pos, depth-1-reduction, true)
+			score = -t.Negamax(-alpha-1, -alpha, depth-1-reduction, true)
 
 			// Re-search at full depth if LMR failed high
 			if reduction > 0 && score > alpha {
-				score = -Negamax(-alpha-1, -alpha, pos, depth-1, true)
+				score = -t.Negamax(-alpha-1, -alpha, depth-1, true)
 			}
 
 			// Re-search with full window if PVS failed high in PV nodes
 			if score > alpha && score < beta {
-				score = -Negamax(-beta, -alpha, pos, depth-1, true)
+				score = -t.Negamax(-beta, -alpha, depth-1, true)
 			}
 		}
 
@@ -293,7 +364,7 @@ func Negamax(alpha, beta Value, pos *PositionNG, depth uint8, doNullMove bool) (
 		movesSearched++
 
 		// Check for search abort
-		if shouldStop() {
+		if t.shouldStop() {
 			return 0
 		}
 
@@ -301,11 +372,11 @@ func Negamax(alpha, beta Value, pos *PositionNG, depth uint8, doNullMove bool) (
 			hashFlag = TT_EXACT
 			bestMove = currentMove
 			alpha = score
-			StorePvMove(currentMove, pos.GamePly)
+			t.StorePvMove(currentMove, pos.GamePly)
 
 			if score >= beta {
 				// Store hash entry with beta flag
-				writeHashEntry(pos.St.Top().key, int16(beta), bestMove, depth, uint8(pos.GamePly), TT_BETA)
+				t.s.tt.writeHashEntry(pos.St.Top().key, int16(beta), bestMove, depth, uint8(pos.GamePly), TT_BETA)
 
 				if !isCapture {
 					// Store killer moves
@@ -341,103 +412,255 @@ func Negamax(alpha, beta Value, pos *PositionNG, depth uint8, doNullMove bool) (
 	}
 
 	// Store hash entry with the score
-	writeHashEntry(pos.St.Top().key, int16(alpha), bestMove, depth, uint8(pos.GamePly), hashFlag)
+	t.s.tt.writeHashEntry(pos.St.Top().key, int16(alpha), bestMove, depth, uint8(pos.GamePly), hashFlag)
 
 	return alpha
 }
 
-// SearchPosition searches for the best move with the given limits.
-func (pos *PositionNG) SearchPosition(depth uint8) (bestMove MoveNG) {
-	return pos.SearchPositionWithLimits(SearchLimits{Depth: depth})
-}
-
-// SearchPositionWithLimits searches with time and depth constraints.
-func (pos *PositionNG) SearchPositionWithLimits(limits SearchLimits) (bestMove MoveNG) {
-	clearSearch(pos)
-	stopFlag.Store(0)
-	now := time.Now()
-	var prevScore Value
+// search runs the Lazy SMP search: every thread iterates deepening on its
+// own copy of the root, and the main thread decides the move.
+func (s *Searcher) search(ts []*searchThread) (res SearchResult) {
+	limits := s.limits
+	// The caller has armed the time-based stop
+	defer s.stopTimer()
 
-	// Set up time-based stop
-	if limits.TimeLimit > 0 {
+	var wg sync.WaitGroup
+	for _, helper := range ts[1:] {
+		wg.Add(1)
 		go func() {
-			time.Sleep(limits.TimeLimit)
-			stopFlag.Store(1)
+			defer wg.Done()
+			helper.iterativeDeepening(limits)
 		}()
 	}
+	res = ts[0].iterativeDeepening(limits)
+	for _, helper := range ts[1:] {
+		helper.stop.Store(true)
+	}
+	wg.Wait()
+
+	res.Nodes = 0
+	for _, t := range ts {
+		res.Nodes += t.pos.Nodes
+	}
+	return res
+}
+
+// isBanned reports whether the root must skip m: it was banned by the GUI,
+// is not among the requested search moves, or is already ranked in an
+// earlier MultiPV line of this iteration.
+func (t *searchThread) isBanned(m MoveNG) bool {
+	if len(t.searchMoves) > 0 && !slices.Contains(t.searchMoves, m) {
+		return true
+	}
+	return slices.Contains(t.banMoves, m) || slices.Contains(t.excluded, m)
+}
+
+// rootMoveCount returns the number of legal root moves that are not banned.
+func (t *searchThread) rootMoveCount() int {
+	var list [MAX_MOVES]MoveNG
+	size := t.pos.GenerateLEGAL(list[:])
+	n := 0
+	for _, m := range list[:size] {
+		if !t.isBanned(m) {
+			n++
+		}
+	}
+	return n
+}
+
+// Helper threads skip some depths so that they spread over different
+// iterations instead of all repeating the main thread's work.
+var (
+	skipSize  = [20]int{1, 1, 2, 2, 2, 2, 3, 3, 3, 3, 3, 3, 4, 4, 4, 4, 4, 4, 4, 4}
+	skipPhase = [20]int{0, 1, 0, 1, 2, 3, 0, 1, 2, 3, 4, 5, 0, 1, 2, 3, 4, 5, 6, 7}
+)
+
+// aspiration searches the root to depth with a window around prevScore,
+// widening it on failure.
+func (t *searchThread) aspiration(prevScore Value, depth uint8) Value {
+	if depth <= 2 {
+		return t.Negamax(-VALUE_INFINITE, VALUE_INFINITE, depth, true)
+	}
+	window := Value(30)
+	alpha := max(prevScore-window, -VALUE_INFINITE)
+	beta := min(prevScore+window, VALUE_INFINITE)
+	score := t.Negamax(alpha, beta, depth, true)
+
+	// Re-search with wider windows if aspiration failed
+	if score <= alpha || score >= beta {
+		// Widen window by 2x
+		window = Value(60)
+		alpha = max(prevScore-window, -VALUE_INFINITE)
+		beta = min(prevScore+window, VALUE_INFINITE)
+		score = t.Negamax(alpha, beta, depth, true)
+
+		// Full window if still failing
+		if score <= alpha || score >= beta {
+			score = t.Negamax(-VALUE_INFINITE, VALUE_INFINITE, depth, true)
+		}
+	}
+	return score
+}
+
+func (t *searchThread) iterativeDeepening(limits SearchLimits) (res SearchResult) {
+	pos := t.pos
+	mainThread := t.id == 0
+	var lines []PVLine
 
 	maxDepth := limits.Depth
 	if maxDepth == 0 {
 		maxDepth = uint8(MAX_PLY)
 	}
 
+	if limits.Mate > 0 {
+		return t.findMate(limits.Mate)
+	}
+
+	// Helpers only fill the hash table, so they search the best line alone.
+	multiPV := 1
+	if mainThread {
+		multiPV = min(max(limits.MultiPV, 1), MaxMultiPV, max(t.rootMoveCount(), 1))
+	}
+
 	// Iterative deepening
 	for currentDepth := uint8(1); currentDepth <= maxDepth; currentDepth++ {
-		alpha := -VALUE_INFINITE
-		beta := VALUE_INFINITE
-
-		// Aspiration windows for depth > 2
-		if currentDepth > 2 {
-			window := Value(30)
-			alpha = max(prevScore-window, -VALUE_INFINITE)
-			beta = min(prevScore+window, VALUE_INFINITE)
+		if !mainThread {
+			i := (t.id - 1) % len(skipSize)
+			if (int(currentDepth)+skipPhase[i])/skipSize[i]%2 != 0 {
+				continue
+			}
 		}
 
-		score := Negamax(alpha, beta, pos, currentDepth, true)
-
-		// Re-search with wider windows if aspiration failed
-		if currentDepth > 2 && (score <= alpha || score >= beta) {
-			// Widen window by 2x
-			window := Value(60)
-			alpha = max(prevScore-window, -VALUE_INFINITE)
-			beta = min(prevScore+window, VALUE_INFINITE)
-			score = Negamax(alpha, beta, pos, currentDepth, true)
-
-			// Full window if still failing
-			if score <= alpha || score >= beta {
-				score = Negamax(-VALUE_INFINITE, VALUE_INFINITE, pos, currentDepth, true)
+		// Rank the root moves one line at a time, excluding the moves
+		// already ranked in this iteration.
+		depthLines := make([]PVLine, 0, multiPV)
+		t.excluded = t.excluded[:0]
+		t.rootDepth = currentDepth
+		for pvIdx := 0; pvIdx < multiPV; pvIdx++ {
+			t.pvIdx = pvIdx
+			t.selDepth = 0
+			var prevScore Value
+			if pvIdx < len(lines) {
+				prevScore = lines[pvIdx].Score
 			}
+			score := t.aspiration(prevScore, currentDepth)
+			stopped := t.shouldStop()
+			if stopped && (currentDepth > 1 || t.pvLength[0] == 0) {
+				break
+			}
+			depthLines = append(depthLines, PVLine{
+				Score:    score,
+				Depth:    currentDepth,
+				SelDepth: t.selDepth,
+				Moves:    slices.Clone(t.pvTable[:t.pvLength[0]]),
+			})
+			if stopped || t.pvLength[0] == 0 {
+				break
+			}
+			t.excluded = append(t.excluded, t.pvTable[0])
 		}
+		t.excluded = t.excluded[:0]
 
-		// If search was stopped mid-iteration, use best move from last complete iteration
-		if shouldStop() && currentDepth > 1 {
+		// If search was stopped mid-iteration, use the lines from the last
+		// complete iteration
+		if t.shouldStop() && currentDepth > 1 {
 			break
 		}
+		if len(depthLines) == 0 {
+			break
+		}
+		slices.SortStableFunc(depthLines, func(a, b PVLine) int {
+			return cmp.Compare(b.Score, a.Score)
+		})
+		lines = depthLines
+		if !mainThread {
+			continue
+		}
 
-		prevScore = score
-		bestMove = PvTable[0]
-
-		fmt.Printf("info score cp %d depth %d nodes %d time %v pv",
-			score, currentDepth, pos.Nodes, time.Since(now))
-		for cnt := 0; cnt < PvLength[0]; cnt++ {
-			fmt.Printf(" %s", Move2Str(PvTable[cnt]))
+		for k, line := range lines {
+			i := Info{
+				Kind:     InfoIteration,
+				Depth:    int(line.Depth),
+				SelDepth: line.SelDepth,
+				Score:    line.Score,
+				PV:       line.Moves,
+			}
+			if multiPV > 1 {
+				i.MultiPV = k + 1
+			}
+			t.s.info(i)
+		}
+		var best MoveNG
+		if len(lines[0].Moves) > 0 {
+			best = lines[0].Moves[0]
+		}
+		if t.s.iterationDone(best, lines[0].Score) {
+			break
 		}
-		fmt.Println()
 	}
 
+	res.Lines = lines
+	var bestMove MoveNG
+	res.PonderMove = MOVE_NONE
+	if len(lines) > 0 && len(lines[0].Moves) > 0 {
+		bestMove = lines[0].Moves[0]
+		if len(lines[0].Moves) > 1 {
+			res.PonderMove = lines[0].Moves[1]
+		}
+	}
+	// Stopped before the first iteration finished: any legal move is better
+	// than none.
 	if bestMove == MOVE_NONE {
-		bestMove = PvTable[0]
+		var list [MAX_MOVES]MoveNG
+		size := pos.GenerateLEGAL(list[:])
+		for i := uint8(0); i < size; i++ {
+			if !t.isBanned(list[i]) {
+				bestMove = list[i]
+				break
+			}
+		}
 	}
-	return bestMove
+	res.BestMove = bestMove
+	return res
 }
 
-func clearSearch(pos *PositionNG) {
-	pos.GamePly = 0
-	pos.Nodes = 0
-	clear(PvTable[:])
-	clear(PvLength[:])
-	clear(pos.Killers[:])
-	// Don't clear history between searches - it accumulates useful data
-	// But apply aging (divide by 2)
-	for c := 0; c < COLOR_NB; c++ {
-		for f := 0; f < SQUARE_NB; f++ {
-			for t := 0; t < SQUARE_NB; t++ {
-				pos.History[c][f][t] /= 2
-			}
+// findMate looks for a forced mate in at most moves moves, trying the
+// shortest first. Every try is a null-window search around the mate score
+// with pruning turned off, so it proves or refutes the mate. Without a mate
+// the result has no best move.
+func (t *searchThread) findMate(moves int) (res SearchResult) {
+	for n := 1; n <= moves && 2*n <= int(MAX_PLY); n++ {
+		t.rootDepth = uint8(2 * n)
+		t.selDepth = 0
+		beta := VALUE_MATE - Value(2*n-1)
+		score := t.Negamax(beta-1, beta, uint8(2*n), true)
+		if t.shouldStop() {
+			break
+		}
+		if score < beta || t.pvLength[0] == 0 {
+			continue
+		}
+		line := PVLine{
+			Score:    score,
+			Depth:    uint8(2 * n),
+			SelDepth: t.selDepth,
+			Moves:    slices.Clone(t.pvTable[:t.pvLength[0]]),
 		}
+		t.s.info(Info{
+			Kind:     InfoIteration,
+			Depth:    int(line.Depth),
+			SelDepth: line.SelDepth,
+			Score:    line.Score,
+			PV:       line.Moves,
+		})
+		res.Lines = []PVLine{line}
+		res.BestMove = line.Moves[0]
+		if len(line.Moves) > 1 {
+			res.PonderMove = line.Moves[1]
+		}
+		break
 	}
-	// Increment TT age
-	age++
+	return res
 }
 
 const (
@@ -448,50 +671,45 @@ const (
 
 const NO_HASH int16 = 32767
 
-func readHashEntry(key Key, alpha, beta int16, bestMove *MoveNG, depth, ply uint8) (int16, MoveNG) {
-	entry := &TT.Entries[key&TT.Mask]
-	if entry.Key == key {
-		*bestMove = entry.Move
-		if entry.Depth >= depth {
-			score := entry.Score
-			if score < -MATE_SCORE {
-				score += int16(ply)
-			}
-			if score > MATE_SCORE {
-				score -= int16(ply)
-			}
-			if entry.Flag == TT_EXACT {
-				return score, entry.Move
-			}
-			if entry.Flag == TT_ALPHA && score <= alpha {
-				return alpha, entry.Move
+func (tt *TransTable) readHashEntry(key Key, alpha, beta int16, bestMove *MoveNG, depth, ply uint8) (int16, MoveNG) {
+	entry, ok := tt.probe(key)
+	if !ok {
+		return NO_HASH, MOVE_NONE
+	}
+	move := MoveNG(entry.move)
+	*bestMove = move
+	if entry.depth() >= depth {
+		score := entry.score
+		if score < -MATE_SCORE {
+			score += int16(ply)
+		}
+		if score > MATE_SCORE {
+			score -= int16(ply)
+		}
+		switch entry.bound() {
+		case TT_EXACT:
+			return score, move
+		case TT_ALPHA:
+			if score <= alpha {
+				return alpha, move
 			}
-			if entry.Flag == TT_BETA && score >= beta {
-				return beta, entry.Move
+		case TT_BETA:
+			if score >= beta {
+				return beta, move
 			}
 		}
-		return NO_HASH, entry.Move
 	}
-	return NO_HASH, MOVE_NONE
+	return NO_HASH, move
 }
 
-// writeHashEntry stores data in the transposition table with age-based replacement.
-func writeHashEntry(key Key, score int16, bestMove MoveNG, depth, ply uint8, flag int8) {
-	entry := &TT.Entries[key&TT.Mask]
+// writeHashEntry stores data in the transposition table, see
+// TransTable.store for the replacement scheme.
+func (tt *TransTable) writeHashEntry(key Key, score int16, bestMove MoveNG, depth, ply uint8, flag int8) {
 	if score < -MATE_SCORE {
 		score -= int16(ply)
 	}
 	if score > MATE_SCORE {
 		score += int16(ply)
 	}
-
-	// Replace if: different age (old search), higher depth, or exact bound
-	if entry.Age != age || entry.Depth <= depth || flag == TT_EXACT {
-		entry.Key = key
-		entry.Score = score
-		entry.Flag = flag
-		entry.Depth = depth
-		entry.Move = bestMove
-		entry.Age = age
-	}
+	tt.store(key, score, bestMove, depth, flag)
 }
@@ -0,0 +1,328 @@
+package engine
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Searcher owns everything a search needs besides the position: the
+// transposition table, the search threads with their PV buffers and stop
+// flags, and the limits and timer of the running search. Independent
+// searchers can run side by side in one process; a single Searcher runs one
+// search at a time.
+type Searcher struct {
+	tt *TransTable
+
+	// mu guards threads and limits.
+	mu      sync.Mutex
+	threads []*searchThread
+	limits  SearchLimits
+
+	// report receives the progress of every search.
+	report func(Info)
+	// running holds the threads of the current search, main thread first;
+	// start is when it began and lastStatus when the main thread last
+	// reported progress.
+	running    []*searchThread
+	start      time.Time
+	lastStatus time.Time
+
+	// Time control state of the running search, guarded by timerMu.
+	// timerGen changes when a search ends, so that a timer firing after
+	// its search cannot stop the next one.
+	timerMu     sync.Mutex
+	timer       *time.Timer
+	timerGen    uint64
+	pondering   bool
+	ponderLimit time.Duration
+	tm          timeManager
+
+	// The opening book probed before every search, nil for none; guarded
+	// by mu.
+	book     *Book
+	bookMode BookMode
+	rnd      *rand.Rand
+
+	// tb holds the endgame tablebases probed by the search, nil for none.
+	tb *Tablebases
+}
+
+// NewSearcher returns a single-threaded searcher with a hash table of
+// DefaultHashSize megabytes that prints its progress to standard output.
+func NewSearcher() *Searcher {
+	return newSearcher(DefaultHashSize)
+}
+
+func newSearcher(hashMB int) *Searcher {
+	s := &Searcher{
+		tt:     NewTranTable(hashMB),
+		report: printInfo,
+		rnd:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	s.threads = []*searchThread{{id: 0, s: s}}
+	return s
+}
+
+// defaultHashSize is the hash table size of the default searcher in
+// megabytes.
+var defaultHashSize = DefaultHashSize
+
+var defaultSearcher = sync.OnceValue(func() *Searcher {
+	return newSearcher(defaultHashSize)
+})
+
+// DefaultSearcher returns the searcher behind the package-level search
+// functions, creating it on first use so that programs with searchers of
+// their own never allocate its hash table.
+func DefaultSearcher() *Searcher {
+	return defaultSearcher()
+}
+
+// SetHashSize replaces the transposition table with an empty one of the
+// given size in megabytes.
+func (s *Searcher) SetHashSize(megabytes int) {
+	s.tt = NewTranTable(megabytes)
+}
+
+// SetReporter makes fn receive the progress reports of later searches; nil
+// silences them. fn is called from the search goroutine.
+func (s *Searcher) SetReporter(fn func(Info)) {
+	s.report = fn
+}
+
+// info fills in the search statistics of i and hands it to the reporter.
+// Only the main thread reports.
+func (s *Searcher) info(i Info) {
+	if s.report == nil {
+		return
+	}
+	i.Nodes = totalNodes(s.running)
+	i.Time = time.Since(s.start)
+	i.HashFull = s.tt.Hashfull()
+	s.lastStatus = time.Now()
+	s.report(i)
+}
+
+// reportStatus sends the search statistics if nothing has been reported
+// for statusInterval, so long iterations still show progress.
+func (s *Searcher) reportStatus() {
+	if time.Since(s.lastStatus) >= statusInterval {
+		s.info(Info{Kind: InfoStatus})
+	}
+}
+
+// SetBook makes later searches play a move of book, picked with mode, when
+// the position is in it; nil turns the book off.
+func (s *Searcher) SetBook(book *Book, mode BookMode) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.book = book
+	s.bookMode = mode
+}
+
+// bookMove returns a move of the opening book for pos, or MOVE_NONE if
+// the book has none or the search is an analysis: infinite, ponder, mate
+// or MultiPV searches always search.
+func (s *Searcher) bookMove(pos *PositionNG, limits SearchLimits) MoveNG {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.book == nil || limits.analysis() {
+		return MOVE_NONE
+	}
+	return s.book.Pick(pos, s.bookMode, s.rnd, limits.allowed)
+}
+
+// SetTablebases makes later searches probe tbs; nil turns them off. It
+// must not be called during a search.
+func (s *Searcher) SetTablebases(tbs *Tablebases) {
+	s.tb = tbs
+}
+
+// tbRoot looks pos up in the tablebases. A won or lost position is played
+// from the tables without searching; in a drawn one the search is limited
+// to the moves that hold the draw. ok reports a result to play.
+func (s *Searcher) tbRoot(pos *PositionNG, limits *SearchLimits) (res SearchResult, ok bool) {
+	if s.tb == nil || limits.analysis() {
+		return res, false
+	}
+	moves, score, found := s.tb.ProbeRoot(pos, limits.allowed)
+	if !found {
+		return res, false
+	}
+	if score == 0 {
+		limits.SearchMoves = moves
+		return res, false
+	}
+	pv := append([]MoveNG{moves[0]}, s.tbContinuation(pos, moves[0])...)
+	res = SearchResult{
+		BestMove: pv[0],
+		Lines:    []PVLine{{Score: score.Value(0), Depth: uint8(len(pv)), Moves: pv}},
+	}
+	if len(pv) > 1 {
+		res.PonderMove = pv[1]
+	}
+	s.mu.Lock()
+	s.running = nil
+	s.start = time.Now()
+	s.mu.Unlock()
+	s.info(Info{Kind: InfoIteration, Depth: len(pv), Score: score.Value(0), PV: pv})
+	return res, true
+}
+
+// tbContinuation returns the tablebase line that follows move m of pos.
+func (s *Searcher) tbContinuation(pos *PositionNG, m MoveNG) []MoveNG {
+	var st StateInfo
+	pos.DoMove(m, &st)
+	defer pos.UndoMove(m)
+	return s.tb.PV(pos)
+}
+
+// ClearHash wipes the transposition table, e.g. when a new game starts.
+func (s *Searcher) ClearHash() {
+	s.tt.Clear()
+}
+
+// Search searches pos with the given limits and returns once it is done.
+// A book move, or a tablebase move in a won or lost ending, is returned
+// without searching.
+func (s *Searcher) Search(pos *PositionNG, limits SearchLimits) SearchResult {
+	if m := s.bookMove(pos, limits); m != MOVE_NONE {
+		return SearchResult{BestMove: m}
+	}
+	if res, ok := s.tbRoot(pos, &limits); ok {
+		return res
+	}
+	ts := s.prepareThreads(pos, limits)
+	s.startTimer(limits)
+	return s.search(ts)
+}
+
+// Start resets the stop signal and runs the search on a new goroutine, so
+// the caller can keep serving commands and abort it with Stop. The result
+// is delivered on the returned channel once the search ends; a book or
+// tablebase move is delivered at once.
+func (s *Searcher) Start(pos *PositionNG, limits SearchLimits) <-chan SearchResult {
+	result := make(chan SearchResult, 1)
+	if m := s.bookMove(pos, limits); m != MOVE_NONE {
+		result <- SearchResult{BestMove: m}
+		return result
+	}
+	if res, ok := s.tbRoot(pos, &limits); ok {
+		result <- res
+		return result
+	}
+	ts := s.prepareThreads(pos, limits)
+	// The time control is set up before the goroutine runs, so that a
+	// PonderHit right after Start is not lost.
+	s.startTimer(limits)
+	go func() {
+		result <- s.search(ts)
+	}()
+	return result
+}
+
+// Stop asks the running search to finish as soon as possible.
+func (s *Searcher) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.threads {
+		t.stop.Store(true)
+	}
+}
+
+// startTimer arms the time-based stop for the search that is about to run.
+// In ponder mode the time limit is kept until PonderHit.
+func (s *Searcher) startTimer(limits SearchLimits) {
+	s.timerMu.Lock()
+	defer s.timerMu.Unlock()
+	s.pondering = limits.Ponder
+	s.ponderLimit = limits.TimeLimit
+	s.tm.reset(limits.SoftTime, limits.Ponder)
+	if !s.pondering && limits.TimeLimit > 0 {
+		s.armTimer(limits.TimeLimit)
+	}
+}
+
+// armTimer stops the running search after d. Called with timerMu held.
+func (s *Searcher) armTimer(d time.Duration) {
+	gen := s.timerGen
+	s.timer = time.AfterFunc(d, func() {
+		s.timerMu.Lock()
+		defer s.timerMu.Unlock()
+		if s.timerGen == gen {
+			s.Stop()
+		}
+	})
+}
+
+func (s *Searcher) stopTimer() {
+	s.timerMu.Lock()
+	defer s.timerMu.Unlock()
+	s.disarmTimer()
+}
+
+// disarmTimer ends the time control of the search. Called with timerMu
+// held.
+func (s *Searcher) disarmTimer() {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	s.timerGen++
+	s.pondering = false
+}
+
+// iterationDone passes the outcome of an iteration of the main thread to
+// the time manager and reports whether to stop before the next one.
+func (s *Searcher) iterationDone(best MoveNG, score Value) bool {
+	s.timerMu.Lock()
+	defer s.timerMu.Unlock()
+	return s.tm.iterationDone(best, score)
+}
+
+// PonderHit switches a ponder search to normal thinking: the opponent played
+// the expected move, so the time limit starts counting now.
+func (s *Searcher) PonderHit() {
+	s.timerMu.Lock()
+	defer s.timerMu.Unlock()
+	if !s.pondering {
+		return
+	}
+	s.pondering = false
+	s.tm.ponderHit()
+	if s.ponderLimit > 0 {
+		s.armTimer(s.ponderLimit)
+	}
+}
+
+// SetThreads sets the number of search threads used by the default searcher.
+func SetThreads(n int) {
+	DefaultSearcher().SetThreads(n)
+}
+
+// StopSearch sets the flag to abort the search of the default searcher.
+func StopSearch() {
+	DefaultSearcher().Stop()
+}
+
+// PonderHit tells the default searcher that the ponder move was played.
+func PonderHit() {
+	DefaultSearcher().PonderHit()
+}
+
+// SearchPosition searches for the best move with the given limits.
+func (pos *PositionNG) SearchPosition(depth uint8) (bestMove MoveNG) {
+	return pos.SearchPositionWithLimits(SearchLimits{Depth: depth})
+}
+
+// SearchPositionWithLimits searches with time and depth constraints.
+func (pos *PositionNG) SearchPositionWithLimits(limits SearchLimits) (bestMove MoveNG) {
+	return DefaultSearcher().Search(pos, limits).BestMove
+}
+
+// StartSearch runs the search on the default searcher in the background;
+// see Searcher.Start.
+func (pos *PositionNG) StartSearch(limits SearchLimits) <-chan SearchResult {
+	return DefaultSearcher().Start(pos, limits)
+}
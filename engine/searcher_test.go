@@ -0,0 +1,263 @@
+package engine
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Searchers share no state, so searching the same position on several of
+// them at once must give the same answer as a lone searcher.
+func TestIndependentSearchersAgree(t *testing.T) {
+	const depth = 4
+	var pos PositionNG
+	if err := pos.Set(initialFen); err != nil {
+		t.Fatal(err)
+	}
+	want := NewSearcher().Search(&pos, SearchLimits{Depth: depth}).BestMove
+	if !IsOKMove(want) {
+		t.Fatal("no best move from the start position")
+	}
+
+	var wg sync.WaitGroup
+	got := make([]MoveNG, 4)
+	for i := range got {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var p PositionNG
+			p.Set(initialFen)
+			got[i] = NewSearcher().Search(&p, SearchLimits{Depth: depth}).BestMove
+		}()
+	}
+	wg.Wait()
+	for i, m := range got {
+		if m != want {
+			t.Errorf("searcher %d: best move %s, want %s", i, Move2Str(m), Move2Str(want))
+		}
+	}
+}
+
+func TestMultiPVRanksDistinctRootMoves(t *testing.T) {
+	var pos PositionNG
+	if err := pos.Set(initialFen); err != nil {
+		t.Fatal(err)
+	}
+	res := NewSearcher().Search(&pos, SearchLimits{Depth: 3, MultiPV: 4})
+	if len(res.Lines) != 4 {
+		t.Fatalf("got %d lines, want 4", len(res.Lines))
+	}
+	seen := map[MoveNG]bool{}
+	for i, line := range res.Lines {
+		if len(line.Moves) == 0 {
+			t.Fatalf("line %d has no moves", i+1)
+		}
+		if seen[line.Moves[0]] {
+			t.Errorf("line %d repeats root move %s", i+1, Move2Str(line.Moves[0]))
+		}
+		seen[line.Moves[0]] = true
+		if i > 0 && line.Score > res.Lines[i-1].Score {
+			t.Errorf("line %d scores %d, above line %d (%d)", i+1, line.Score, i, res.Lines[i-1].Score)
+		}
+	}
+	if res.BestMove != res.Lines[0].Moves[0] {
+		t.Errorf("best move %s is not the first line's move %s", Move2Str(res.BestMove), Move2Str(res.Lines[0].Moves[0]))
+	}
+}
+
+func TestMultiPVIsBoundedByLegalMoves(t *testing.T) {
+	var pos PositionNG
+	// Red king alone on its back rank with a single legal move.
+	if err := pos.Set("3k5/9/9/9/9/9/9/9/3r5/4K4 w - - 0 1"); err != nil {
+		t.Fatal(err)
+	}
+	var list [MAX_MOVES]MoveNG
+	legal := int(pos.GenerateLEGAL(list[:]))
+	res := NewSearcher().Search(&pos, SearchLimits{Depth: 2, MultiPV: 10})
+	if len(res.Lines) != legal {
+		t.Fatalf("got %d lines, want one per legal move (%d)", len(res.Lines), legal)
+	}
+}
+
+func TestNodeLimitIsExactAndDeterministic(t *testing.T) {
+	const budget = 20000
+	var results []SearchResult
+	for range 2 {
+		var pos PositionNG
+		if err := pos.Set(initialFen); err != nil {
+			t.Fatal(err)
+		}
+		s := NewSearcher()
+		s.SetThreads(4)
+		s.SetReporter(nil)
+		results = append(results, s.Search(&pos, SearchLimits{Nodes: budget}))
+	}
+	for i, res := range results {
+		if res.Nodes != budget {
+			t.Errorf("search %d used %d nodes, want %d", i, res.Nodes, budget)
+		}
+	}
+	a, b := results[0], results[1]
+	if a.BestMove != b.BestMove || a.PonderMove != b.PonderMove ||
+		!slices.Equal(a.Lines[0].Moves, b.Lines[0].Moves) || a.Lines[0].Score != b.Lines[0].Score {
+		t.Errorf("node-limited searches differ: %v vs %v", a, b)
+	}
+}
+
+// A node-limited search must not depend on the hash and history left by
+// the searches before it.
+func TestNodeLimitIsDeterministicOnWarmSearcher(t *testing.T) {
+	var pos PositionNG
+	if err := pos.Set(initialFen); err != nil {
+		t.Fatal(err)
+	}
+	s := NewSearcher()
+	s.SetReporter(nil)
+	s.Search(&pos, SearchLimits{Depth: 5})
+	a := s.Search(&pos, SearchLimits{Nodes: 20000})
+	s.Search(&pos, SearchLimits{Depth: 4, MultiPV: 3})
+	b := s.Search(&pos, SearchLimits{Nodes: 20000})
+	if a.BestMove != b.BestMove || !slices.Equal(a.Lines[0].Moves, b.Lines[0].Moves) || a.Lines[0].Score != b.Lines[0].Score {
+		t.Errorf("node-limited searches differ: %v vs %v", a, b)
+	}
+}
+
+func TestMateSearch(t *testing.T) {
+	// Mate in one, e.g. Rb7-b9 with the rook on a8 covering rank 8.
+	const fen = "4k4/R8/1R7/9/9/9/9/9/9/3K5 w - - 0 1"
+	var pos PositionNG
+	if err := pos.Set(fen); err != nil {
+		t.Fatal(err)
+	}
+	var reports []Info
+	s := NewSearcher()
+	s.SetReporter(func(i Info) { reports = append(reports, i) })
+	res := s.Search(&pos, SearchLimits{Mate: 2})
+	if !IsOKMove(res.BestMove) {
+		t.Fatal("no mate found")
+	}
+	var st StateInfo
+	pos.DoMove(res.BestMove, &st)
+	var list [MAX_MOVES]MoveNG
+	if n := pos.GenerateLEGAL(list[:]); n != 0 {
+		t.Errorf("%s leaves black %d legal moves", Move2Str(res.BestMove), n)
+	}
+	if len(reports) == 0 || !strings.Contains(reports[len(reports)-1].String(), "score mate 1 ") {
+		t.Errorf("mate not reported as mate 1: %v", reports)
+	}
+
+	// The proof ignores the scores left in the hash by pruned searches.
+	var warm PositionNG
+	if err := warm.Set(fen); err != nil {
+		t.Fatal(err)
+	}
+	s.SetReporter(nil)
+	s.Search(&warm, SearchLimits{Depth: 6})
+	if res := s.Search(&warm, SearchLimits{Mate: 1}); !IsOKMove(res.BestMove) {
+		t.Error("no mate found on a warm searcher")
+	}
+
+	if err := pos.Set(initialFen); err != nil {
+		t.Fatal(err)
+	}
+	if res := NewSearcher().Search(&pos, SearchLimits{Mate: 2}); res.BestMove != MOVE_NONE {
+		t.Errorf("found mate %s in the start position", Move2Str(res.BestMove))
+	}
+}
+
+func TestSearchMovesRestrictsRoot(t *testing.T) {
+	var pos PositionNG
+	if err := pos.Set(initialFen); err != nil {
+		t.Fatal(err)
+	}
+	var only []MoveNG
+	for _, s := range []string{"a3a4", "i0i1"} {
+		m, err := ParseUCIMove(&pos, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		only = append(only, m)
+	}
+	s := NewSearcher()
+	s.SetReporter(nil)
+	res := s.Search(&pos, SearchLimits{Depth: 3, MultiPV: 5, SearchMoves: only})
+	if len(res.Lines) != len(only) {
+		t.Fatalf("got %d lines, want %d", len(res.Lines), len(only))
+	}
+	for _, line := range res.Lines {
+		if !slices.Contains(only, line.Moves[0]) {
+			t.Errorf("searched %s outside searchmoves", Move2Str(line.Moves[0]))
+		}
+	}
+}
+
+// Helper threads share the hash table with the main thread; run with -race.
+func TestLazySMPSharesTable(t *testing.T) {
+	var pos PositionNG
+	if err := pos.Set(initialFen); err != nil {
+		t.Fatal(err)
+	}
+	s := NewSearcher()
+	s.SetThreads(4)
+	s.SetReporter(func(Info) {})
+	if res := s.Search(&pos, SearchLimits{Depth: 5}); !IsOKMove(res.BestMove) {
+		t.Error("no best move")
+	}
+}
+
+// The search counts plies from its root, but the position keeps its move
+// number.
+func TestSearchKeepsFullmoveNumber(t *testing.T) {
+	const fen = "2bakab2/4n4/3c1r3/p1p1p1p1p/2n6/3R5/P1P1P1P1P/2N1C4/4A4/2BAK4 w - - 12 23"
+	var pos PositionNG
+	if err := pos.Set(fen); err != nil {
+		t.Fatal(err)
+	}
+	best := pos.SearchPositionWithLimits(SearchLimits{Depth: 3})
+	if got := pos.FEN(); got != fen {
+		t.Fatalf("FEN after search %q, want %q", got, fen)
+	}
+	var st StateInfo
+	pos.DoMove(best, &st)
+	if got := strings.Fields(pos.FEN()); got[1] != "b" || got[5] != "23" {
+		t.Errorf("FEN after the best move %q, want move 23 for black", got)
+	}
+}
+
+// A time limit that expires as its search ends must not stop the next one.
+func TestLateTimerKeepsNextSearch(t *testing.T) {
+	s := NewSearcher()
+	s.startTimer(SearchLimits{TimeLimit: time.Millisecond})
+	s.timerMu.Lock()
+	time.Sleep(20 * time.Millisecond) // the timer fires and waits for the lock
+	s.disarmTimer()
+	s.timerMu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	if s.threads[0].stop.Load() {
+		t.Error("the timer of a finished search stopped the next one")
+	}
+}
+
+// A ponderhit sent right after the search starts must start its clock.
+func TestImmediatePonderHit(t *testing.T) {
+	var pos PositionNG
+	if err := pos.Set(initialFen); err != nil {
+		t.Fatal(err)
+	}
+	s := NewSearcher()
+	s.SetReporter(nil)
+	result := s.Start(&pos, SearchLimits{Ponder: true, TimeLimit: 50 * time.Millisecond})
+	s.PonderHit()
+	select {
+	case res := <-result:
+		if res.BestMove == MOVE_NONE {
+			t.Error("no best move")
+		}
+	case <-time.After(10 * time.Second):
+		s.Stop()
+		<-result
+		t.Fatal("the search ignored the ponderhit")
+	}
+}
@@ -0,0 +1,500 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// An endgame tablebase holds the outcome of every position of one material
+// balance, such as KRKAA for rook against two advisors, with the distance
+// to mate. Repetition rules and the 60-move rule are not modelled: a
+// position that cannot be forced to mate counts as a draw.
+//
+// Tables are named by the pieces of each side after its king, strongest
+// first. A table covers the color-flipped material too, so only the
+// canonical one of the two is stored: the side with more pieces, or with
+// the stronger pieces, is Red.
+
+// TBScore is the outcome of a tablebase position for the side to move: 0
+// for a draw, n > 0 when it mates in n plies, and -n-1 when it is mated in
+// n plies.
+type TBScore int16
+
+// Value converts s to a search score at ply plies from the root.
+func (s TBScore) Value(ply int) Value {
+	switch {
+	case s > 0:
+		return Value(MATE_VALUE) - Value(ply+int(s))
+	case s < 0:
+		return -Value(MATE_VALUE) + Value(ply+int(-s-1))
+	}
+	return 0
+}
+
+// parent returns the score of a position whose move leads to a position
+// of score s.
+func (s TBScore) parent() TBScore {
+	switch {
+	case s < 0:
+		return -s
+	case s > 0:
+		return -s - 2
+	}
+	return 0
+}
+
+// rank orders scores from the point of view of the side to move: faster
+// wins and slower losses rank higher.
+func (s TBScore) rank() int {
+	switch {
+	case s > 0:
+		return 1<<20 - int(s)
+	case s < 0:
+		return -1<<20 - int(s)
+	}
+	return 0
+}
+
+// tbOrder lists the non-king piece types from strongest to weakest, the
+// order of the pieces in table names and indexes.
+var tbOrder = [...]PieceType{ROOK, CANNON, KNIGHT, PAWN, ADVISOR, BISHOP}
+
+// MaxTablebaseSize bounds the positions per side to move of a table, so
+// that its generation, at five bytes per position, fits in memory. Besides
+// the kings it holds two rooks, knights, cannons or pawns with up to two
+// advisors and bishops, as in KRKNA or KRKCAB, or one of them with up to
+// four, as in KRKAABB; KRCKN is too large.
+const MaxTablebaseSize = 1 << 25
+
+// binomial[n][k] is the number of ways to choose k of n squares.
+var binomial = func() (b [SQUARE_NB + 1][6]int) {
+	for n := range b {
+		b[n][0] = 1
+		for k := 1; n > 0 && k < len(b[n]); k++ {
+			b[n][k] = b[n-1][k-1] + b[n-1][k]
+		}
+	}
+	return b
+}()
+
+// tbMaterial counts the non-king pieces of each side.
+type tbMaterial [COLOR_NB][PIECE_TYPE_NB]int
+
+func parseMaterial(name string) (tbMaterial, error) {
+	var m tbMaterial
+	sides := strings.Split(strings.ToUpper(name), "K")
+	if len(sides) != 3 || sides[0] != "" {
+		return m, fmt.Errorf("bad material %q: want K<pieces>K<pieces>", name)
+	}
+	for c, pieces := range sides[1:] {
+		for _, ch := range pieces {
+			pc := parsePiece(ch)
+			if pc == NO_PIECE || TypeOf(pc) == KING {
+				return m, fmt.Errorf("bad material %q: bad piece %q", name, ch)
+			}
+			m[c][TypeOf(pc)]++
+			if m[c][TypeOf(pc)] > maxPieceCount[TypeOf(pc)] {
+				return m, fmt.Errorf("bad material %q: too many %c", name, ch)
+			}
+		}
+	}
+	return m, nil
+}
+
+func materialOf(pos *PositionNG) tbMaterial {
+	var m tbMaterial
+	for c := Color(WHITE); c < COLOR_NB; c++ {
+		for _, pt := range tbOrder {
+			m[c][pt] = pos.PieceCount[MakePieceNG(c, pt)]
+		}
+	}
+	return m
+}
+
+// materialKey packs the piece counts of pos like tbMaterial.key, those of
+// side first first.
+func materialKey(pos *PositionNG, first Color) uint64 {
+	var k uint64
+	for _, c := range [COLOR_NB]Color{first, notColor(first)} {
+		for _, pt := range tbOrder {
+			k = k<<3 | uint64(pos.PieceCount[MakePieceNG(c, pt)])
+		}
+	}
+	return k
+}
+
+func (m tbMaterial) key() uint64 {
+	var k uint64
+	for c := range COLOR_NB {
+		for _, pt := range tbOrder {
+			k = k<<3 | uint64(m[c][pt])
+		}
+	}
+	return k
+}
+
+func (m tbMaterial) flipped() tbMaterial {
+	return tbMaterial{m[BLACK], m[WHITE]}
+}
+
+func (m tbMaterial) count(c Color) int {
+	n := 0
+	for _, pt := range tbOrder {
+		n += m[c][pt]
+	}
+	return n
+}
+
+func (m tbMaterial) pieces() int {
+	return m.count(WHITE) + m.count(BLACK)
+}
+
+// canonical reports whether m, rather than its flip, names the table.
+func (m tbMaterial) canonical() bool {
+	if w, b := m.count(WHITE), m.count(BLACK); w != b {
+		return w > b
+	}
+	for _, pt := range tbOrder {
+		if m[WHITE][pt] != m[BLACK][pt] {
+			return m[WHITE][pt] > m[BLACK][pt]
+		}
+	}
+	return true
+}
+
+func (m tbMaterial) String() string {
+	var sb strings.Builder
+	for c := range COLOR_NB {
+		sb.WriteByte('K')
+		for _, pt := range tbOrder {
+			for range m[c][pt] {
+				sb.WriteByte(pieceChar(pt))
+			}
+		}
+	}
+	return sb.String()
+}
+
+// tbSlot is the set of identical pieces of a table index with the squares
+// they may stand on. It takes size values of the index, one for every
+// combination of count squares.
+type tbSlot struct {
+	pc      Piece
+	count   int
+	squares []Square
+	index   [SQUARE_NB]int16 // position of a square in squares, -1 if absent
+	size    int
+	stride  int
+}
+
+// Tablebase is the table of one material balance. Its index is the side
+// to move followed by the squares of every kind of piece in turn: the
+// kings, then Red's and Black's other pieces in table order. Identical
+// pieces count as one combination of squares, ranked in colex order, so
+// swapping them gives the same index.
+type Tablebase struct {
+	mat    tbMaterial
+	slots  []tbSlot
+	size   int // positions per side to move
+	scores []TBScore
+}
+
+func newTablebase(m tbMaterial) (*Tablebase, error) {
+	t := &Tablebase{mat: m}
+	t.addSlot(W_KING, 1)
+	t.addSlot(B_KING, 1)
+	for c := Color(WHITE); c < COLOR_NB; c++ {
+		for _, pt := range tbOrder {
+			if m[c][pt] > 0 {
+				t.addSlot(MakePieceNG(c, pt), m[c][pt])
+			}
+		}
+	}
+	t.size = 1
+	for i := len(t.slots) - 1; i >= 0; i-- {
+		t.slots[i].stride = t.size
+		t.size *= t.slots[i].size
+		if t.size > MaxTablebaseSize {
+			return nil, fmt.Errorf("tablebase %v too large", m)
+		}
+	}
+	return t, nil
+}
+
+func (t *Tablebase) addSlot(pc Piece, count int) {
+	s := tbSlot{pc: pc, count: count}
+	for i := range s.index {
+		s.index[i] = -1
+	}
+	for b := legalSquares(pc); b.IsNotZero(); {
+		sq := PopLsb(&b)
+		s.index[sq] = int16(len(s.squares))
+		s.squares = append(s.squares, sq)
+	}
+	s.size = binomial[len(s.squares)][count]
+	t.slots = append(t.slots, s)
+}
+
+// Name returns the material of the table, such as KRKAA.
+func (t *Tablebase) Name() string {
+	return t.mat.String()
+}
+
+// index returns the index of pos, whose material is that of t or, with
+// flip, its color flip.
+func (t *Tablebase) index(pos *PositionNG, flip bool) int {
+	idx := 0
+	for i := range t.slots {
+		s := &t.slots[i]
+		c := ColorOf(s.pc)
+		if flip {
+			c = notColor(c)
+		}
+		var found [5]int16
+		n := 0
+		for b := pos.Pieces(c, TypeOf(s.pc)); b.IsNotZero(); n++ {
+			sq := PopLsb(&b)
+			if flip {
+				sq = flipSquare(sq)
+			}
+			found[n] = s.index[sq]
+			for j := n; j > 0 && found[j] < found[j-1]; j-- {
+				found[j], found[j-1] = found[j-1], found[j]
+			}
+		}
+		rank := 0
+		for j, k := range found[:n] {
+			rank += binomial[k][j+1]
+		}
+		idx += rank * s.stride
+	}
+	side := pos.SideToMove
+	if flip {
+		side = notColor(side)
+	}
+	return int(side)*t.size + idx
+}
+
+type tbRef struct {
+	t    *Tablebase
+	flip bool
+}
+
+// Tablebases is a set of tables to probe.
+type Tablebases struct {
+	tables    map[uint64]tbRef
+	maxPieces int
+}
+
+// NewTablebases returns an empty set.
+func NewTablebases() *Tablebases {
+	return &Tablebases{tables: make(map[uint64]tbRef)}
+}
+
+// Add makes t available to probes.
+func (tbs *Tablebases) Add(t *Tablebase) {
+	tbs.tables[t.mat.key()] = tbRef{t: t}
+	if flip := t.mat.flipped(); flip.key() != t.mat.key() {
+		tbs.tables[flip.key()] = tbRef{t: t, flip: true}
+	}
+	tbs.maxPieces = max(tbs.maxPieces, t.mat.pieces())
+}
+
+// Len returns the number of tables in the set.
+func (tbs *Tablebases) Len() int {
+	n := 0
+	for _, r := range tbs.tables {
+		if !r.flip {
+			n++
+		}
+	}
+	return n
+}
+
+func (tbs *Tablebases) has(m tbMaterial) bool {
+	_, ok := tbs.tables[m.key()]
+	return ok
+}
+
+// Probe returns the score of pos if a table covers it.
+func (tbs *Tablebases) Probe(pos *PositionNG) (TBScore, bool) {
+	if int(pos.PiecesAllColor(ALL_PIECES).PopCount())-2 > tbs.maxPieces {
+		return 0, false
+	}
+	r, ok := tbs.tables[materialKey(pos, WHITE)]
+	if !ok {
+		return 0, false
+	}
+	return r.t.scores[r.t.index(pos, r.flip)], true
+}
+
+// ProbeRoot returns the moves of pos accepted by allowed, which may be
+// nil, that keep the best outcome, best first: the fastest wins, the
+// slowest losses or every drawing move. ok is false if some move leads to
+// a position no table covers.
+func (tbs *Tablebases) ProbeRoot(pos *PositionNG, allowed func(MoveNG) bool) (moves []MoveNG, score TBScore, ok bool) {
+	var list [MAX_MOVES]MoveNG
+	var scores []TBScore
+	for _, m := range list[:pos.GenerateLEGAL(list[:])] {
+		if allowed != nil && !allowed(m) {
+			continue
+		}
+		var st StateInfo
+		pos.DoMove(m, &st)
+		s, found := tbs.Probe(pos)
+		pos.UndoMove(m)
+		if !found {
+			return nil, 0, false
+		}
+		s = s.parent()
+		// Insert by rank, keeping only the moves of the best outcome.
+		i := len(moves)
+		for i > 0 && s.rank() > scores[i-1].rank() {
+			i--
+		}
+		moves = append(moves[:i], append([]MoveNG{m}, moves[i:]...)...)
+		scores = append(scores[:i], append([]TBScore{s}, scores[i:]...)...)
+	}
+	if len(moves) == 0 {
+		return nil, 0, false
+	}
+	best := scores[0]
+	n := 1
+	for n < len(scores) && (scores[n] > 0) == (best > 0) && (scores[n] < 0) == (best < 0) {
+		n++
+	}
+	return moves[:n], best, true
+}
+
+// PV returns the moves from pos that keep the tablebase outcome, up to
+// mate, or nil if pos is not won or lost.
+func (tbs *Tablebases) PV(pos *PositionNG) []MoveNG {
+	var pv []MoveNG
+	var states [MAX_MOVES]StateInfo
+	for len(pv) < len(states) {
+		moves, score, ok := tbs.ProbeRoot(pos, nil)
+		if !ok || score == 0 {
+			break
+		}
+		pos.DoMove(moves[0], &states[len(pv)])
+		pv = append(pv, moves[0])
+	}
+	for i := len(pv) - 1; i >= 0; i-- {
+		pos.UndoMove(pv[i])
+	}
+	return pv
+}
+
+// A tablebase file is a header followed by the scores of every index, all
+// little endian:
+//
+//	magic   [8]byte  "GDPEGTB\x00"
+//	version uint32   tbFileVersion
+//	_       uint32   reserved, 0
+//	name    [16]byte material, NUL padded
+//	size    uint64   positions per side to move
+//	scores  2 * size * int16
+const tbFileVersion = 2
+
+// TablebaseExt is the file name extension of tablebase files.
+const TablebaseExt = ".gtb"
+
+var tbFileMagic = [8]byte{'G', 'D', 'P', 'E', 'G', 'T', 'B', 0}
+
+type tbFileHeader struct {
+	Magic    [8]byte
+	Version  uint32
+	Reserved uint32
+	Name     [16]byte
+	Size     uint64
+}
+
+// ErrTablebaseFile reports a file that is not a table for this engine.
+var ErrTablebaseFile = errors.New("incompatible tablebase file")
+
+// Write writes the table to w.
+func (t *Tablebase) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	hdr := tbFileHeader{Magic: tbFileMagic, Version: tbFileVersion, Size: uint64(t.size)}
+	copy(hdr.Name[:], t.Name())
+	if err := binary.Write(bw, binary.LittleEndian, &hdr); err != nil {
+		return err
+	}
+	if err := binary.Write(bw, binary.LittleEndian, t.scores); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// ReadTablebase reads a table written by Tablebase.Write.
+func ReadTablebase(r io.Reader) (*Tablebase, error) {
+	br := bufio.NewReader(r)
+	var hdr tbFileHeader
+	if err := binary.Read(br, binary.LittleEndian, &hdr); err != nil {
+		return nil, fmt.Errorf("read tablebase header: %w", err)
+	}
+	if hdr.Magic != tbFileMagic {
+		return nil, fmt.Errorf("%w: not a tablebase", ErrTablebaseFile)
+	}
+	if hdr.Version != tbFileVersion {
+		return nil, fmt.Errorf("%w: version %d, want %d", ErrTablebaseFile, hdr.Version, tbFileVersion)
+	}
+	name := strings.TrimRight(string(hdr.Name[:]), "\x00")
+	m, err := parseMaterial(name)
+	if err != nil || !m.canonical() || m.String() != name {
+		return nil, fmt.Errorf("%w: bad material %q", ErrTablebaseFile, name)
+	}
+	t, err := newTablebase(m)
+	if err != nil {
+		return nil, err
+	}
+	if hdr.Size != uint64(t.size) {
+		return nil, fmt.Errorf("%w: %s has %d positions, want %d", ErrTablebaseFile, name, hdr.Size, t.size)
+	}
+	t.scores = make([]TBScore, 2*t.size)
+	if err := binary.Read(br, binary.LittleEndian, t.scores); err != nil {
+		return nil, fmt.Errorf("read %s scores: %w", name, err)
+	}
+	return t, nil
+}
+
+// Save writes the table to its file in dir.
+func (t *Tablebase) Save(dir string) error {
+	f, err := os.Create(filepath.Join(dir, t.Name()+TablebaseExt))
+	if err != nil {
+		return err
+	}
+	if err := t.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadTablebases loads every table file in dir.
+func LoadTablebases(dir string) (*Tablebases, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+TablebaseExt))
+	if err != nil {
+		return nil, err
+	}
+	tbs := NewTablebases()
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		t, err := ReadTablebase(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		tbs.Add(t)
+	}
+	return tbs, nil
+}
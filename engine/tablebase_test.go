@@ -0,0 +1,265 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// krkMateIn3 is the longest win of rook against bare king: Ra8 forces
+// Kf7 and Re8 leaves the king no move.
+const krkMateIn3 = "9/9/4k4/9/9/9/9/9/9/R2K5 w - - 0 1"
+
+func generate(t *testing.T, names ...string) *Tablebases {
+	t.Helper()
+	tbs := NewTablebases()
+	for _, name := range names {
+		if _, err := tbs.Generate(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return tbs
+}
+
+func TestTablebaseNames(t *testing.T) {
+	for name, want := range map[string]string{
+		"KRKAA": "KAAKR",
+		"kaakr": "KAAKR",
+		"KPKN":  "KNKP",
+		"KCAK":  "KCAK",
+		"KRKR":  "KRKR",
+	} {
+		m, err := parseMaterial(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !m.canonical() {
+			m = m.flipped()
+		}
+		if m.String() != want {
+			t.Errorf("%s: table %s, want %s", name, m, want)
+		}
+	}
+	for _, bad := range []string{"KRK5", "RKK", "KRRRK", "KK K"} {
+		if _, err := parseMaterial(bad); err == nil {
+			t.Errorf("%q parsed", bad)
+		}
+	}
+}
+
+// TestTablebaseConsistent checks every position of small tables against
+// its moves: its score must be the best of theirs, and a position without
+// moves is mated.
+func TestTablebaseConsistent(t *testing.T) {
+	tbs := generate(t, "KPK", "KRK", "KPPK")
+	for _, name := range []string{"KK", "KPK", "KRK", "KPPK"} {
+		m, _ := parseMaterial(name)
+		tb := tbs.tables[m.key()].t
+		s := &tbSolver{t: tb, tbs: tbs}
+		s.pos.resetToEmpty()
+		wins := 0
+		for i := range 2 * tb.size {
+			if !s.setup(i) {
+				continue
+			}
+			got, _ := tbs.Probe(&s.pos)
+			want := TBScore(-1)
+			if _, best, ok := tbs.ProbeRoot(&s.pos, nil); ok {
+				want = best
+			}
+			if got != want {
+				t.Fatalf("%s %s: score %d, its moves give %d", name, s.pos.FEN(), got, want)
+			}
+			if got > 0 {
+				wins++
+			}
+		}
+		if name != "KK" && wins == 0 {
+			t.Errorf("%s has no wins", name)
+		}
+	}
+}
+
+func TestTablebaseProbe(t *testing.T) {
+	tbs := generate(t, "KRK", "KCK")
+	for _, c := range []struct {
+		fen  string
+		want TBScore
+	}{
+		{krkMateIn3, 3},
+		// The same position with colors flipped, from the other table half.
+		{"r2k5/9/9/9/9/9/9/4K4/9/9 b - - 0 1", 3},
+		{"9/4R4/5k3/9/9/9/9/9/9/3K5 b - - 0 1", -1},
+		{"4k4/9/9/9/9/9/9/9/9/C2K5 w - - 0 1", 0},
+	} {
+		var pos PositionNG
+		if err := pos.Set(c.fen); err != nil {
+			t.Fatal(err)
+		}
+		if got, ok := tbs.Probe(&pos); !ok || got != c.want {
+			t.Errorf("%s: got %d %v, want %d", c.fen, got, ok, c.want)
+		}
+	}
+	var pos PositionNG
+	if err := pos.Set(initialFen); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tbs.Probe(&pos); ok {
+		t.Error("start position found in the tables")
+	}
+}
+
+func TestTablebaseFileRoundTrip(t *testing.T) {
+	tbs := generate(t, "KRK")
+	dir := t.TempDir()
+	m, _ := parseMaterial("KRK")
+	tb := tbs.tables[m.key()].t
+	if err := tb.Save(dir); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadTablebases(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Len() != 1 {
+		t.Fatalf("loaded %d tables, want 1", loaded.Len())
+	}
+	got := loaded.tables[m.key()].t
+	if got.Name() != "KRK" || !slices.Equal(got.scores, tb.scores) {
+		t.Error("loaded table differs")
+	}
+
+	var saved bytes.Buffer
+	if err := tb.Write(&saved); err != nil {
+		t.Fatal(err)
+	}
+	for name, off := range map[string]int{"magic": 0, "version": 8, "name": 17, "size": 32} {
+		data := bytes.Clone(saved.Bytes())
+		data[off] ^= 1
+		if _, err := ReadTablebase(bytes.NewReader(data)); !errors.Is(err, ErrTablebaseFile) {
+			t.Errorf("%s: got error %v, want ErrTablebaseFile", name, err)
+		}
+	}
+	if _, err := ReadTablebase(bytes.NewReader(saved.Bytes()[:100])); err == nil {
+		t.Error("truncated table loaded")
+	}
+	if _, err := LoadTablebases(filepath.Join(dir, "missing")); err != nil {
+		t.Errorf("empty directory: %v", err)
+	}
+}
+
+func TestSearcherUsesTablebases(t *testing.T) {
+	s := NewSearcher()
+	s.SetHashSize(1)
+	s.SetReporter(nil)
+	s.SetTablebases(generate(t, "KRK"))
+	var pos PositionNG
+	if err := pos.Set(krkMateIn3); err != nil {
+		t.Fatal(err)
+	}
+
+	r := s.Search(&pos, SearchLimits{Depth: 10})
+	if r.Nodes != 0 || len(r.Lines) != 1 || len(r.Lines[0].Moves) != 3 {
+		t.Fatalf("got %+v, want the three-ply tablebase line without searching", r)
+	}
+	if r.Lines[0].Score != VALUE_MATE-3 || Move2Str(r.BestMove) != "a0a8" {
+		t.Errorf("got %s score %d, want a0a8 mating in 3 plies", Move2Str(r.BestMove), r.Lines[0].Score)
+	}
+
+	// Analysis searches, and the probes below the root give the exact
+	// mate score at once.
+	r = s.Search(&pos, SearchLimits{Depth: 2, MultiPV: 2})
+	if r.Nodes == 0 || r.Lines[0].Score != VALUE_MATE-3 {
+		t.Errorf("analysis got score %d after %d nodes, want mate in 3 plies", r.Lines[0].Score, r.Nodes)
+	}
+}
+
+// Identical pieces share one combination of squares in the index.
+func TestTablebaseIndexCombinations(t *testing.T) {
+	for name, want := range map[string]int{
+		"KRK":     9 * 9 * 90,
+		"KRRK":    9 * 9 * 90 * 89 / 2,
+		"KRKAABB": 9 * 9 * 90 * (5 * 4 / 2) * (7 * 6 / 2),
+	} {
+		m, _ := parseMaterial(name)
+		tb, err := newTablebase(m)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if tb.size != want {
+			t.Errorf("%s: %d positions, want %d", name, tb.size, want)
+		}
+	}
+	for name, fits := range map[string]bool{"KRKNA": true, "KRKCAB": true, "KRCKN": false} {
+		m, _ := parseMaterial(name)
+		if _, err := newTablebase(m); (err == nil) != fits {
+			t.Errorf("%s: got error %v", name, err)
+		}
+	}
+
+	// Every legal index sets up a position with that index.
+	m, _ := parseMaterial("KPPKAA")
+	tb, err := newTablebase(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &tbSolver{t: tb}
+	s.pos.resetToEmpty()
+	legal := 0
+	for i := range 2 * tb.size {
+		if !s.setup(i) {
+			continue
+		}
+		legal++
+		if got := tb.index(&s.pos, false); got != i {
+			t.Fatalf("%s: index %d, want %d", s.pos.FEN(), got, i)
+		}
+	}
+	if legal < tb.size {
+		t.Errorf("only %d of %d indexes legal", legal, 2*tb.size)
+	}
+}
+
+// The parents found by unmaking moves are those whose moves lead to a
+// position, as the forward move generator finds them.
+func TestTablebaseParents(t *testing.T) {
+	for _, name := range []string{"KCKA", "KNKB", "KPKA", "KABKAB"} {
+		m, _ := parseMaterial(name)
+		tb, err := newTablebase(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := &tbSolver{t: tb}
+		s.pos.resetToEmpty()
+		want := make(map[int][]int)
+		var list [MAX_MOVES]MoveNG
+		for i := range 2 * tb.size {
+			if !s.setup(i) {
+				continue
+			}
+			for _, m := range list[:s.pos.GenerateLEGAL(list[:])] {
+				if s.pos.Board[ToSQ(m)] != NO_PIECE {
+					continue
+				}
+				var st StateInfo
+				s.pos.DoMove(m, &st)
+				to := tb.index(&s.pos, false)
+				s.pos.UndoMove(m)
+				want[to] = append(want[to], i)
+			}
+		}
+		for i := range 2 * tb.size {
+			if !s.setup(i) {
+				continue
+			}
+			var got []int
+			s.forEachParent(func(p int) { got = append(got, p) })
+			slices.Sort(got)
+			if !slices.Equal(got, want[i]) {
+				t.Fatalf("%s %s: parents %v, want %v", name, s.pos.FEN(), got, want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+)
+
+// While a table is solved, the score of a position not decided yet is
+// tbUnknown, or tbQueued+n once it is queued to be decided n plies from
+// mate. Decided scores stay within tbMaxPly of zero.
+const (
+	tbUnknown = math.MinInt16
+	tbQueued  = tbUnknown + 1
+	tbMaxPly  = 1 << 14
+)
+
+// tbCaptureHolds marks a position with a capture that draws or wins.
+const tbCaptureHolds TBScore = -1
+
+// Generate computes the table of the named material, such as "KRKAA", or of
+// its color flip, and adds it to tbs. The tables that its captures lead to
+// are taken from tbs or generated first. It returns the new tables, those
+// it depends on first; none if tbs already has the table.
+func (tbs *Tablebases) Generate(name string) ([]*Tablebase, error) {
+	m, err := parseMaterial(name)
+	if err != nil {
+		return nil, err
+	}
+	if !m.canonical() {
+		m = m.flipped()
+	}
+	return tbs.generate(m)
+}
+
+func (tbs *Tablebases) generate(m tbMaterial) ([]*Tablebase, error) {
+	if tbs.has(m) {
+		return nil, nil
+	}
+	var made []*Tablebase
+	for c := range COLOR_NB {
+		for _, pt := range tbOrder {
+			if m[c][pt] == 0 {
+				continue
+			}
+			sub := m
+			sub[c][pt]--
+			if !sub.canonical() {
+				sub = sub.flipped()
+			}
+			deps, err := tbs.generate(sub)
+			if err != nil {
+				return nil, err
+			}
+			made = append(made, deps...)
+		}
+	}
+	t, err := newTablebase(m)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.solve(tbs); err != nil {
+		return nil, err
+	}
+	tbs.Add(t)
+	return append(made, t), nil
+}
+
+// tbSolver holds the state of a table while it is solved: besides the
+// scores, three bytes per position. The moves into a position are not
+// stored but unmade from it when it is decided.
+type tbSolver struct {
+	t   *Tablebase
+	tbs *Tablebases
+	pos PositionNG
+	st  StateInfo
+
+	// Per index: moves to positions of the table not yet known to win for
+	// the opponent, and tbCaptureHolds or the slowest win the opponent
+	// gets by a capture.
+	remain  []uint8
+	capLoss []TBScore
+
+	// queued[n] counts the indexes queued to be decided n plies from mate.
+	queued []int
+}
+
+// solve fills in the scores of t by retrograde analysis. Every position is
+// set up once to count its moves; then the outcomes spread from the mates,
+// one ply at a time, to the positions that lead to them, found by unmaking
+// the moves of each position decided.
+func (t *Tablebase) solve(tbs *Tablebases) error {
+	n := 2 * t.size
+	s := &tbSolver{
+		t:       t,
+		tbs:     tbs,
+		remain:  make([]uint8, n),
+		capLoss: make([]TBScore, n),
+	}
+	s.pos.resetToEmpty()
+	t.scores = make([]TBScore, n)
+	for i := range t.scores {
+		t.scores[i] = tbUnknown
+	}
+	if err := s.countMoves(); err != nil {
+		return err
+	}
+
+	for ply := 0; ply < len(s.queued); ply++ {
+		// Deciding a position queues others only at later plies.
+		want := tbQueued + TBScore(ply)
+		for i := 0; s.queued[ply] > 0; i++ {
+			if t.scores[i] != want {
+				continue
+			}
+			s.queued[ply]--
+			if ply%2 == 1 {
+				t.scores[i] = TBScore(ply)
+			} else {
+				t.scores[i] = TBScore(-ply - 1)
+			}
+			s.setup(i)
+			s.forEachParent(func(p int) {
+				if decided(t.scores[p]) {
+					return
+				}
+				if ply%2 == 0 {
+					s.push(p, ply+1)
+					return
+				}
+				s.remain[p]--
+				if s.remain[p] == 0 && s.capLoss[p] != tbCaptureHolds {
+					s.push(p, max(ply, int(s.capLoss[p]))+1)
+				}
+			})
+		}
+	}
+	for i, v := range t.scores {
+		if !decided(v) {
+			t.scores[i] = 0
+		}
+	}
+	return nil
+}
+
+// decided reports whether v is a score rather than tbUnknown or queued.
+func decided(v TBScore) bool {
+	return v >= tbQueued+tbMaxPly
+}
+
+// push queues index i to be decided ply plies from mate, unless it is
+// decided or queued for an earlier ply.
+func (s *tbSolver) push(i, ply int) {
+	v := s.t.scores[i]
+	switch {
+	case decided(v):
+		return
+	case v != tbUnknown:
+		old := int(v - tbQueued)
+		if old <= ply {
+			return
+		}
+		s.queued[old]--
+	}
+	for len(s.queued) <= ply {
+		s.queued = append(s.queued, 0)
+	}
+	s.queued[ply]++
+	s.t.scores[i] = tbQueued + TBScore(ply)
+}
+
+// capture scores a capture from index from, made on s.pos, with the table
+// it leads to.
+func (s *tbSolver) capture(from int) error {
+	v, ok := s.tbs.Probe(&s.pos)
+	if !ok {
+		return fmt.Errorf("tablebase %v missing", materialOf(&s.pos))
+	}
+	switch {
+	case v < 0:
+		// Of several winning captures the fastest is decided first.
+		s.push(from, int(v.parent()))
+		s.capLoss[from] = tbCaptureHolds
+	case v == 0:
+		s.capLoss[from] = tbCaptureHolds
+	case s.capLoss[from] != tbCaptureHolds:
+		s.capLoss[from] = max(s.capLoss[from], v)
+	}
+	return nil
+}
+
+// countMoves sets up every legal index of the table in turn, counts its
+// moves within the table and scores its captures. It queues the positions
+// decided by their moves alone: mates, and those whose every move is a
+// capture that loses.
+func (s *tbSolver) countMoves() error {
+	t := s.t
+	var list [MAX_MOVES]MoveNG
+	for i := range 2 * t.size {
+		if !s.setup(i) {
+			continue
+		}
+		n := s.pos.GenerateLEGAL(list[:])
+		for _, m := range list[:n] {
+			if s.pos.Board[ToSQ(m)] == NO_PIECE {
+				s.remain[i]++
+				continue
+			}
+			var st StateInfo
+			s.pos.DoMove(m, &st)
+			err := s.capture(i)
+			s.pos.UndoMove(m)
+			if err != nil {
+				return err
+			}
+		}
+		switch {
+		case n == 0:
+			s.push(i, 0)
+		case s.remain[i] == 0 && s.capLoss[i] != tbCaptureHolds:
+			s.push(i, int(s.capLoss[i])+1)
+		}
+	}
+	return nil
+}
+
+// forEachParent calls fn with the index of every position that reaches
+// the one on s.pos by a move that is not a capture. It unmakes each move
+// of the side that just moved and keeps the positions where the side to
+// move now was not in check.
+func (s *tbSolver) forEachParent(fn func(p int)) {
+	pos := &s.pos
+	us := pos.SideToMove
+	them := notColor(us)
+	occupied := pos.PiecesAllColor(ALL_PIECES)
+	pos.SideToMove = them
+	for b := pos.Pieces(them); b.IsNotZero(); {
+		to := PopLsb(&b)
+		for froms := unmoveSquares(pos.Board[to], to, occupied); froms.IsNotZero(); {
+			from := PopLsb(&froms)
+			pos.MovePiece(to, from)
+			if !pos.CheckersTo2(them, pos.KingSQ[us]).IsNotZero() {
+				fn(s.t.index(pos, false))
+			}
+			pos.MovePiece(from, to)
+		}
+	}
+	pos.SideToMove = us
+}
+
+// unmoveSquares returns the empty squares from which pc reaches to by a
+// move that is not a capture.
+func unmoveSquares(pc Piece, to Square, occupied Bitboard) Bitboard {
+	var b Bitboard
+	switch TypeOf(pc) {
+	case ROOK, CANNON:
+		b = AttacksBB(ROOK, to, occupied)
+	case KNIGHT:
+		b = AttacksBB(KNIGHT_TO, to, occupied)
+	case PAWN:
+		b = PawnAttacksTo[ColorOf(pc)][to]
+	default:
+		// King, advisor and bishop moves go both ways.
+		b = AttacksBB(TypeOf(pc), to, occupied)
+	}
+	return b.And(occupied.Not()).And(legalSquares(pc))
+}
+
+// setup places the position of index i on s.pos and reports whether it is
+// legal: no two pieces on one square and the side that just moved not in
+// check.
+func (s *tbSolver) setup(i int) bool {
+	t := s.t
+	side := Color(i / t.size)
+	rest := i % t.size
+	var squares [16]Square
+	var pieces [16]Piece
+	n := 0
+	occupied := From64(0)
+	for j := range t.slots {
+		slot := &t.slots[j]
+		// Unrank the combination of squares, the highest first.
+		r := rest / slot.stride % slot.size
+		k := len(slot.squares)
+		for c := slot.count; c > 0; c-- {
+			k--
+			for binomial[k][c] > r {
+				k--
+			}
+			r -= binomial[k][c]
+			sq := slot.squares[k]
+			if occupied.And(SquareBB[sq]).IsNotZero() {
+				return false
+			}
+			occupied = occupied.Or(SquareBB[sq])
+			squares[n], pieces[n] = sq, slot.pc
+			n++
+		}
+	}
+
+	pos := &s.pos
+	for b := pos.PiecesAllColor(ALL_PIECES); b.IsNotZero(); {
+		pos.RemovePiece(PopLsb(&b))
+	}
+	for j := range n {
+		pos.PutPiece(pieces[j], squares[j])
+	}
+	pos.SideToMove = side
+	pos.KingSQ[WHITE] = squares[0]
+	pos.KingSQ[BLACK] = squares[1]
+	pos.GamePly = 0
+	s.st = StateInfo{}
+	pos.St = append(pos.St[:0], &s.st)
+	pos.SetState()
+	return !pos.CheckersTo2(side, pos.KingSQ[notColor(side)]).IsNotZero()
+}
@@ -0,0 +1,146 @@
+package engine
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// MaxThreads bounds the number of search threads.
+const MaxThreads = 256
+
+// searchThread is one Lazy SMP worker. Each thread searches its own copy of
+// the root position, so it has its own history, killer and counter-move
+// tables, and its own PV; only the transposition table is shared.
+type searchThread struct {
+	id  int
+	s   *Searcher
+	pos *PositionNG
+	// own is the private root copy searched by helper threads; the main
+	// thread searches the caller's position directly.
+	own PositionNG
+
+	pvTable  [MAX_MOVES * MAX_MOVES]MoveNG
+	pvLength [MAX_MOVES]int
+
+	// banMoves holds the moves the root of the current search skips;
+	// searchMoves, if not empty, the only moves it may search.
+	banMoves    []MoveNG
+	searchMoves []MoveNG
+	// rootDepth and pvIdx locate the current iteration and MultiPV line;
+	// selDepth is the deepest ply reached in it.
+	rootDepth uint8
+	pvIdx     int
+	selDepth  int
+
+	// nodeLimit is the node budget of the search, 0 for none.
+	nodeLimit int
+	// proving turns off the unsound pruning while looking for a forced
+	// mate.
+	proving bool
+
+	// excluded holds the root moves already ranked in earlier MultiPV lines
+	// of the current iteration.
+	excluded []MoveNG
+
+	// stop is set when the thread should abort its search.
+	stop atomic.Bool
+	// nodes mirrors pos.Nodes so other threads can read it while searching.
+	nodes atomic.Int64
+}
+
+// SetThreads sets the number of search threads used by later searches.
+func (s *Searcher) SetThreads(n int) {
+	n = min(MaxThreads, max(1, n))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.threads) < n {
+		s.threads = append(s.threads, &searchThread{id: len(s.threads), s: s})
+	}
+	s.threads = s.threads[:n]
+}
+
+func (t *searchThread) shouldStop() bool {
+	return t.stop.Load()
+}
+
+// outOfNodes stops the search once the node budget of a node-limited
+// search is spent.
+func (t *searchThread) outOfNodes() bool {
+	if t.nodeLimit > 0 && t.pos.Nodes >= t.nodeLimit {
+		t.stop.Store(true)
+		return true
+	}
+	return false
+}
+
+// prepareThreads resets every thread for a new search from pos and returns
+// them, main thread first.
+func (s *Searcher) prepareThreads(pos *PositionNG, limits SearchLimits) []*searchThread {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limits = limits
+	threads := s.threads
+	// A node budget must be spent the same way every time, and the mate
+	// finder is a single proof search, so both run on the main thread alone.
+	if limits.Nodes > 0 || limits.Mate > 0 {
+		threads = threads[:1]
+	}
+	// Nor may the hash of earlier searches steer a node-limited one.
+	if limits.Nodes > 0 {
+		s.tt.Clear()
+	}
+	for _, t := range threads {
+		if t.id == 0 {
+			t.pos = pos
+		} else {
+			pos.copyTo(&t.own)
+			t.pos = &t.own
+		}
+		t.banMoves = limits.BanMoves
+		t.searchMoves = limits.SearchMoves
+		t.nodeLimit = limits.Nodes
+		t.proving = limits.Mate > 0
+		t.stop.Store(false)
+		t.clear()
+	}
+	// Increment TT age
+	s.tt.age++
+	s.running = append([]*searchThread(nil), threads...)
+	s.start = time.Now()
+	s.lastStatus = s.start
+	return s.running
+}
+
+func (t *searchThread) clear() {
+	pos := t.pos
+	pos.rootPly += pos.GamePly
+	pos.GamePly = 0
+	pos.Nodes = 0
+	t.nodes.Store(0)
+	clear(t.pvTable[:])
+	clear(t.pvLength[:])
+	clear(pos.Killers[:])
+	if t.nodeLimit > 0 {
+		pos.History = HistoryTable{}
+		pos.CounterMoves = [PIECE_NB][SQUARE_NB]MoveNG{}
+		return
+	}
+	// Don't clear history between searches - it accumulates useful data
+	// But apply aging (divide by 2)
+	for c := 0; c < COLOR_NB; c++ {
+		for f := 0; f < SQUARE_NB; f++ {
+			for to := 0; to < SQUARE_NB; to++ {
+				pos.History[c][f][to] /= 2
+			}
+		}
+	}
+}
+
+// totalNodes returns the nodes searched so far by all threads.
+func totalNodes(ts []*searchThread) int {
+	nodes := 0
+	for _, t := range ts {
+		nodes += int(t.nodes.Load())
+	}
+	return nodes
+}
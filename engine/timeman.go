@@ -0,0 +1,143 @@
+package engine
+
+import "time"
+
+// moveOverhead is kept in reserve on every move to absorb GUI and pipe lag.
+const moveOverhead = 50 * time.Millisecond
+
+// hardLimitRatio is how many soft limits the search may run before it is
+// stopped in the middle of an iteration.
+const hardLimitRatio = 3
+
+// suddenDeathMoves is the number of moves a sudden-death clock is assumed
+// to last.
+const suddenDeathMoves = 30
+
+// TimeControl describes the clocks sent with a go command.
+type TimeControl struct {
+	Time      time.Duration // our remaining time
+	Increment time.Duration // added to our clock after each move
+	MovesToGo int           // moves until the next time control, 0 for sudden death
+
+	OppTime      time.Duration
+	OppIncrement time.Duration
+	OppMovesToGo int
+
+	// Ponder is set when the GUI lets us think on the opponent's time,
+	// so part of each budget is expected back through ponder hits.
+	Ponder bool
+}
+
+// available returns the time left on our clock after the move overhead.
+func (tc TimeControl) available() time.Duration {
+	avail := tc.Time - moveOverhead
+	if avail <= 0 {
+		avail = tc.Time / 2
+	}
+	return avail
+}
+
+// Budget returns the soft and hard time limits of the current move. The
+// search starts no new iteration once the soft limit, scaled by the
+// stability of the best move, has passed; it is stopped at the hard limit.
+func (tc TimeControl) Budget() (soft, hard time.Duration) {
+	soft = tc.Allocate()
+	hard = min(soft*hardLimitRatio, tc.available()*8/10)
+	return soft, max(soft, hard)
+}
+
+// Allocate returns how long to think about the current move, which is the
+// soft limit of Budget.
+func (tc TimeControl) Allocate() time.Duration {
+	avail := tc.available()
+
+	var alloc time.Duration
+	if tc.MovesToGo > 0 {
+		// Spread the clock over the remaining moves, leaving half a move
+		// worth of reserve for the last one.
+		moves := min(tc.MovesToGo, suddenDeathMoves)
+		alloc = avail * 2 / time.Duration(2*moves+1)
+	} else {
+		alloc = avail/suddenDeathMoves + tc.Increment*3/4
+	}
+
+	if tc.Ponder {
+		alloc += alloc / 4
+	}
+
+	// Play faster when behind on the clock, in proportion to our share
+	// of the opponent's time but never below half.
+	if tc.OppTime > 0 && tc.Time < tc.OppTime {
+		permille := max(tc.Time, tc.OppTime/2) * 1000 / tc.OppTime
+		alloc = alloc * permille / 1000
+	}
+
+	// Don't use more than 80% of remaining time, nor less than a minimum
+	// that still fits in the clock.
+	alloc = min(alloc, avail*8/10)
+	return max(alloc, min(100*time.Millisecond, avail/2))
+}
+
+// Percentages of the soft limit the search may use, depending on how the
+// best move and score evolve between iterations.
+const (
+	scaleBestMoveChanged = 150 // the best move just changed
+	scaleStablePerIter   = 10  // taken off for every iteration it stays
+	scaleMin             = 50
+	scaleMax             = 200
+)
+
+// timeManager decides between iterations whether another one is worth
+// starting. The clock is a field so tests can drive it.
+type timeManager struct {
+	now       func() time.Time
+	start     time.Time
+	soft      time.Duration // 0 disables the soft limit
+	pondering bool
+
+	bestMove MoveNG
+	score    Value
+	stable   int // iterations the best move has stayed the same
+	scale    int // percent of soft the search may use
+}
+
+// reset starts timing a new search. While pondering the clock does not
+// run until ponderHit.
+func (tm *timeManager) reset(soft time.Duration, ponder bool) {
+	if tm.now == nil {
+		tm.now = time.Now
+	}
+	*tm = timeManager{now: tm.now, start: tm.now(), soft: soft, pondering: ponder, scale: 100}
+}
+
+func (tm *timeManager) ponderHit() {
+	tm.pondering = false
+	tm.start = tm.now()
+}
+
+// iterationDone records the best move and score of a finished iteration
+// and reports whether the search should stop instead of starting the next.
+// A changed best move or a falling score buys more time; a best move that
+// stays the same iteration after iteration gives time back.
+func (tm *timeManager) iterationDone(best MoveNG, score Value) bool {
+	first := tm.bestMove == MOVE_NONE
+	if !first && best != tm.bestMove {
+		tm.stable = 0
+		tm.scale = scaleBestMoveChanged
+	} else {
+		if !first {
+			tm.stable++
+		}
+		tm.scale = max(100-scaleStablePerIter*tm.stable, scaleMin)
+	}
+	if drop := tm.score - score; !first && drop > 0 {
+		tm.scale += int(min(drop, 100)) / 2
+	}
+	tm.scale = min(tm.scale, scaleMax)
+	tm.bestMove, tm.score = best, score
+
+	if tm.soft == 0 || tm.pondering {
+		return false
+	}
+	return tm.now().Sub(tm.start) >= tm.soft*time.Duration(tm.scale)/100
+}
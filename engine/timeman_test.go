@@ -0,0 +1,149 @@
+package engine
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAllocatePonder(t *testing.T) {
+	for _, tc := range []TimeControl{
+		{Time: 60 * time.Second},
+		{Time: 60 * time.Second, Increment: 2 * time.Second},
+		{Time: 10 * time.Second, MovesToGo: 20},
+	} {
+		base := tc.Allocate()
+		tc.Ponder = true
+		if got, want := tc.Allocate(), base+base/4; got != want {
+			t.Errorf("%+v: got %v, want %v", tc, got, want)
+		}
+	}
+}
+
+// fakeClock is a manually advanced clock for the time manager.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestTimeManager(soft time.Duration, ponder bool) (*timeManager, *fakeClock) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	tm := &timeManager{now: clock.now}
+	tm.reset(soft, ponder)
+	return tm, clock
+}
+
+func TestBudgetBounds(t *testing.T) {
+	cases := []TimeControl{
+		{Time: 60 * time.Second},
+		{Time: 60 * time.Second, Increment: 2 * time.Second},
+		{Time: 10 * time.Second, MovesToGo: 1},
+		{Time: 300 * time.Millisecond},
+	}
+	for _, tc := range cases {
+		soft, hard := tc.Budget()
+		if soft != tc.Allocate() {
+			t.Errorf("%+v: soft %v differs from Allocate %v", tc, soft, tc.Allocate())
+		}
+		if soft <= 0 || hard < soft {
+			t.Errorf("%+v: bad budget soft %v hard %v", tc, soft, hard)
+		}
+		if hard > tc.Time {
+			t.Errorf("%+v: hard limit %v exceeds the clock", tc, hard)
+		}
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	const s = time.Second
+	for _, c := range []struct {
+		name string
+		tc   TimeControl
+		want time.Duration
+	}{
+		// A thirtieth of the clock after the move overhead.
+		{"sudden death", TimeControl{Time: 60 * s}, 1998333333},
+		{"moves to go", TimeControl{Time: 10 * s, MovesToGo: 9}, 1047368421},
+		{"last move", TimeControl{Time: 10 * s, MovesToGo: 1}, 6633333333},
+		{"increment", TimeControl{Time: 60 * s, Increment: 3 * s}, 1998333333 + 2250*time.Millisecond},
+		{"ponder", TimeControl{Time: 60 * s, Ponder: true}, 1998333333 + 499583333},
+		{"ahead", TimeControl{Time: 60 * s, OppTime: 30 * s}, 1998333333},
+		{"slightly behind", TimeControl{Time: 50 * s, OppTime: 60 * s}, 1665000000 * 833 / 1000},
+		{"half the time", TimeControl{Time: 30 * s, OppTime: 60 * s}, 998333333 / 2},
+		{"far behind", TimeControl{Time: 10 * s, OppTime: 60 * s}, 331666666 / 2},
+		{"short clock", TimeControl{Time: 300 * time.Millisecond}, 100 * time.Millisecond},
+	} {
+		if got := c.tc.Allocate(); got != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestStableBestMoveStopsBeforeSoftLimit(t *testing.T) {
+	tm, clock := newTestTimeManager(time.Second, false)
+	for i := 0; i < 5; i++ {
+		clock.advance(100 * time.Millisecond)
+		if tm.iterationDone(MoveNG(42), 20) {
+			t.Fatalf("stopped after %v", clock.t.Sub(tm.start))
+		}
+	}
+	// Six iterations with the same move halve the budget.
+	clock.advance(100 * time.Millisecond)
+	if !tm.iterationDone(MoveNG(42), 20) {
+		t.Errorf("still iterating after %v with a stable best move", clock.t.Sub(tm.start))
+	}
+}
+
+func TestChangingBestMoveExtendsSoftLimit(t *testing.T) {
+	tm, clock := newTestTimeManager(time.Second, false)
+	tm.iterationDone(MoveNG(42), 20)
+	clock.advance(1200 * time.Millisecond)
+	if tm.iterationDone(MoveNG(43), 20) {
+		t.Error("stopped right after the best move changed")
+	}
+	clock.advance(400 * time.Millisecond)
+	if !tm.iterationDone(MoveNG(43), 20) {
+		t.Error("still iterating past the extended limit")
+	}
+}
+
+func TestFallingScoreExtendsSoftLimit(t *testing.T) {
+	tm, clock := newTestTimeManager(time.Second, false)
+	tm.iterationDone(MoveNG(42), 100)
+	clock.advance(1100 * time.Millisecond)
+	if tm.iterationDone(MoveNG(42), 0) {
+		t.Error("stopped right after the score fell")
+	}
+
+	tm, clock = newTestTimeManager(time.Second, false)
+	tm.iterationDone(MoveNG(42), 100)
+	clock.advance(1100 * time.Millisecond)
+	if !tm.iterationDone(MoveNG(42), 100) {
+		t.Error("still iterating past the soft limit with a steady score")
+	}
+}
+
+func TestSoftLimitWaitsForPonderHit(t *testing.T) {
+	tm, clock := newTestTimeManager(time.Second, true)
+	clock.advance(time.Minute)
+	if tm.iterationDone(MoveNG(42), 0) {
+		t.Fatal("stopped while pondering")
+	}
+	tm.ponderHit()
+	clock.advance(500 * time.Millisecond)
+	if tm.iterationDone(MoveNG(42), 0) {
+		t.Error("ponder time counted against the soft limit")
+	}
+	clock.advance(time.Second)
+	if !tm.iterationDone(MoveNG(42), 0) {
+		t.Error("still iterating after the soft limit")
+	}
+}
+
+func TestNoSoftLimit(t *testing.T) {
+	tm, clock := newTestTimeManager(0, false)
+	clock.advance(time.Hour)
+	if tm.iterationDone(MoveNG(42), 0) {
+		t.Error("stopped without a soft limit")
+	}
+}
@@ -1,16 +1,20 @@
 package engine
 
-import (
-	"unsafe"
-)
+import "sync/atomic"
 
+// TTEntry is one slot of the transposition table. It keeps only the upper
+// 16 bits of the position key: the lower bits already chose its cluster.
+//
+// In the table an entry is packed into one 64-bit word that is read and
+// written atomically, so search threads share the table without locks: a
+// reader sees either the old or the new entry, never a mix of both, and
+// the key bits in the same word tell whether it belongs to the position.
 type TTEntry struct {
-	Key   Key
-	Score int16
-	Depth uint8
-	Flag  int8
-	Move  MoveNG
-	Age   uint8
+	key16    uint16
+	move     uint16
+	score    int16
+	depth8   uint8 // search depth + 1, 0 for an empty slot
+	genBound uint8 // search age in the upper 6 bits, bound in the lower 2
 }
 
 const (
@@ -19,15 +23,50 @@ const (
 	TT_EXACT
 )
 
-type TransTable struct {
-	Entries []TTEntry
-	Mask    uint64
+// Hash table size limits in megabytes.
+const (
+	MinHashSize     = 1
+	MaxHashSize     = 4096
+	DefaultHashSize = 16
+)
+
+// clusterSize entries of 8 bytes fill a 64-byte cache line, so a probe
+// touches a single line.
+const clusterSize = 8
+
+// clusterBytes is the size of a cluster.
+const clusterBytes = 8 * clusterSize
+
+type ttCluster struct {
+	entries [clusterSize]atomic.Uint64
+}
+
+func (e TTEntry) pack() uint64 {
+	return uint64(e.key16) | uint64(e.move)<<16 | uint64(uint16(e.score))<<32 |
+		uint64(e.depth8)<<48 | uint64(e.genBound)<<56
 }
 
-var (
-	TT  = NewTranTable(16)
+func unpackEntry(w uint64) TTEntry {
+	return TTEntry{
+		key16:    uint16(w),
+		move:     uint16(w >> 16),
+		score:    int16(w >> 32),
+		depth8:   uint8(w >> 48),
+		genBound: uint8(w >> 56),
+	}
+}
+
+// ageMask keeps the bits of the search age stored in an entry.
+const ageMask = 0x3f
+
+type TransTable struct {
+	clusters []ttCluster
+	mask     uint64
+
+	// age is bumped at the start of every search so entries from older
+	// searches can be replaced first.
 	age uint8
-)
+}
 
 func roundPowerOfTwo(size int) int {
 	x := 1
@@ -38,11 +77,96 @@ func roundPowerOfTwo(size int) int {
 }
 
 func NewTranTable(megabytes int) *TransTable {
-	megabytes = min(4096, max(1, megabytes))
-	size := 1024 * 1024 * megabytes / int(unsafe.Sizeof(TTEntry{}))
+	megabytes = min(MaxHashSize, max(MinHashSize, megabytes))
+	size := roundPowerOfTwo(1024 * 1024 * megabytes / clusterBytes)
 	return &TransTable{
-		Entries: make([]TTEntry, size),
-		Mask:    uint64(roundPowerOfTwo(size - 1)),
+		clusters: make([]ttCluster, size),
+		mask:     uint64(size - 1),
 	}
 }
 
+func (e TTEntry) depth() uint8 { return e.depth8 - 1 }
+
+func (e TTEntry) bound() int8 { return int8(e.genBound & 3) }
+
+func (e TTEntry) gen() uint8 { return e.genBound >> 2 }
+
+// relativeAge returns how many searches ago e was written.
+func (tt *TransTable) relativeAge(e TTEntry) int {
+	return int((tt.age - e.gen()) & ageMask)
+}
+
+// probe returns a copy of the entry of the position with the given key.
+func (tt *TransTable) probe(key Key) (TTEntry, bool) {
+	c := &tt.clusters[key&tt.mask]
+	key16 := uint16(key >> 48)
+	for i := range c.entries {
+		if e := unpackEntry(c.entries[i].Load()); e.key16 == key16 && e.depth8 != 0 {
+			return e, true
+		}
+	}
+	return TTEntry{}, false
+}
+
+// store saves a search result. It reuses the slot of the same position if
+// there is one, and otherwise evicts the least valuable entry of the
+// cluster: the shallowest, counting each search of age as 8 plies.
+func (tt *TransTable) store(key Key, score int16, move MoveNG, depth uint8, bound int8) {
+	c := &tt.clusters[key&tt.mask]
+	key16 := uint16(key >> 48)
+	depth8 := min(depth, 254) + 1
+
+	slot := 0
+	replace := unpackEntry(c.entries[0].Load())
+	for i := range c.entries {
+		e := unpackEntry(c.entries[i].Load())
+		if e.depth8 == 0 || e.key16 == key16 {
+			slot, replace = i, e
+			break
+		}
+		if int(e.depth8)-8*tt.relativeAge(e) < int(replace.depth8)-8*tt.relativeAge(replace) {
+			slot, replace = i, e
+		}
+	}
+
+	if replace.depth8 != 0 && replace.key16 == key16 {
+		if move == MOVE_NONE {
+			move = MoveNG(replace.move)
+		}
+		// A deeper result of this search is worth more than a shallow
+		// bound.
+		if bound != TT_EXACT && tt.relativeAge(replace) == 0 && depth8+4 <= replace.depth8 {
+			replace.move = uint16(move)
+			c.entries[slot].Store(replace.pack())
+			return
+		}
+	}
+	c.entries[slot].Store(TTEntry{
+		key16:    key16,
+		move:     uint16(move),
+		score:    score,
+		depth8:   depth8,
+		genBound: (tt.age&ageMask)<<2 | uint8(bound),
+	}.pack())
+}
+
+// Hashfull returns how many entries per thousand were written by the
+// current search, sampled from the start of the table.
+func (tt *TransTable) Hashfull() int {
+	n := min(1000/clusterSize, len(tt.clusters))
+	used := 0
+	for i := range n {
+		for j := range tt.clusters[i].entries {
+			if e := unpackEntry(tt.clusters[i].entries[j].Load()); e.depth8 != 0 && tt.relativeAge(e) == 0 {
+				used++
+			}
+		}
+	}
+	return used * 1000 / (n * clusterSize)
+}
+
+// Clear wipes all entries, e.g. when a new game starts. It must not run
+// during a search.
+func (tt *TransTable) Clear() {
+	clear(tt.clusters)
+}
@@ -0,0 +1,122 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// A saved hash table is a header followed by the packed entries of every
+// cluster, all little endian like the tablebases; only opening books keep
+// the big endian order of Polyglot:
+//
+//	magic    [8]byte  "GDPHASH\x00"
+//	version  uint32   ttFileVersion
+//	age      uint32   search age of the table
+//	seed     uint64   zobristSeed
+//	sideKey  uint64   Zobrist key of the side to move, to catch generator changes
+//	clusters uint64   number of clusters
+//	entries  clusters * clusterSize * uint64
+const ttFileVersion = 1
+
+var ttFileMagic = [8]byte{'G', 'D', 'P', 'H', 'A', 'S', 'H', 0}
+
+type ttFileHeader struct {
+	Magic    [8]byte
+	Version  uint32
+	Age      uint32
+	Seed     uint64
+	SideKey  uint64
+	Clusters uint64
+}
+
+// ErrHashFile reports a hash file that does not fit this engine or table.
+var ErrHashFile = errors.New("incompatible hash file")
+
+// Save writes the table to w. It must not run during a search.
+func (tt *TransTable) Save(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	hdr := ttFileHeader{
+		Magic:    ttFileMagic,
+		Version:  ttFileVersion,
+		Age:      uint32(tt.age),
+		Seed:     zobristSeed,
+		SideKey:  zkey.side,
+		Clusters: uint64(len(tt.clusters)),
+	}
+	if err := binary.Write(bw, binary.LittleEndian, &hdr); err != nil {
+		return err
+	}
+	var buf [clusterBytes]byte
+	for i := range tt.clusters {
+		for j := range tt.clusters[i].entries {
+			binary.LittleEndian.PutUint64(buf[8*j:], tt.clusters[i].entries[j].Load())
+		}
+		if _, err := bw.Write(buf[:]); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// Load replaces the contents of the table with a table saved by Save. The
+// file must come from an engine with the same Zobrist keys and a table of
+// the same size; otherwise Load returns an error wrapping ErrHashFile and
+// leaves the table alone. A file cut short leaves the table empty. Load
+// must not run during a search.
+func (tt *TransTable) Load(r io.Reader) error {
+	br := bufio.NewReader(r)
+	var hdr ttFileHeader
+	if err := binary.Read(br, binary.LittleEndian, &hdr); err != nil {
+		return fmt.Errorf("read hash file header: %w", err)
+	}
+	switch {
+	case hdr.Magic != ttFileMagic:
+		return fmt.Errorf("%w: not a hash file", ErrHashFile)
+	case hdr.Version != ttFileVersion:
+		return fmt.Errorf("%w: version %d, want %d", ErrHashFile, hdr.Version, ttFileVersion)
+	case hdr.Seed != zobristSeed || hdr.SideKey != zkey.side:
+		return fmt.Errorf("%w: made with other Zobrist keys (seed %d)", ErrHashFile, hdr.Seed)
+	case hdr.Clusters != uint64(len(tt.clusters)):
+		return fmt.Errorf("%w: table of %d MB, current table is %d MB", ErrHashFile,
+			hdr.Clusters*clusterBytes>>20, uint64(len(tt.clusters))*clusterBytes>>20)
+	}
+	var buf [clusterBytes]byte
+	for i := range tt.clusters {
+		if _, err := io.ReadFull(br, buf[:]); err != nil {
+			tt.Clear()
+			return fmt.Errorf("read hash file entries: %w", err)
+		}
+		for j := range tt.clusters[i].entries {
+			tt.clusters[i].entries[j].Store(binary.LittleEndian.Uint64(buf[8*j:]))
+		}
+	}
+	tt.age = uint8(hdr.Age)
+	return nil
+}
+
+// SaveHash writes the hash table to the named file.
+func (s *Searcher) SaveHash(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := s.tt.Save(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadHash fills the hash table from a file written by SaveHash.
+func (s *Searcher) LoadHash(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return s.tt.Load(f)
+}
@@ -0,0 +1,83 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestTTSaveLoadRoundTrip(t *testing.T) {
+	var pos PositionNG
+	if err := pos.Set(initialFen); err != nil {
+		t.Fatal(err)
+	}
+	s := NewSearcher()
+	s.SetHashSize(1)
+	s.SetReporter(nil)
+	s.Search(&pos, SearchLimits{Depth: 5})
+
+	path := filepath.Join(t.TempDir(), "hash.bin")
+	if err := s.SaveHash(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewSearcher()
+	loaded.SetHashSize(1)
+	if err := loaded.LoadHash(path); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.tt.age != s.tt.age {
+		t.Errorf("age %d, want %d", loaded.tt.age, s.tt.age)
+	}
+	for i := range s.tt.clusters {
+		for j := range s.tt.clusters[i].entries {
+			if got, want := loaded.tt.clusters[i].entries[j].Load(), s.tt.clusters[i].entries[j].Load(); got != want {
+				t.Fatalf("cluster %d entry %d: %#x, want %#x", i, j, got, want)
+			}
+		}
+	}
+	if _, ok := loaded.tt.probe(pos.Key()); !ok {
+		t.Error("root position missing from the loaded table")
+	}
+}
+
+func TestTTLoadRejectsIncompatibleFiles(t *testing.T) {
+	tt := NewTranTable(1)
+	tt.store(clusterKey(1, 0), 5, MOVE_NONE, 3, TT_EXACT)
+	var saved bytes.Buffer
+	if err := tt.Save(&saved); err != nil {
+		t.Fatal(err)
+	}
+	patch := func(off int, v uint64) []byte {
+		b := bytes.Clone(saved.Bytes())
+		binary.LittleEndian.PutUint64(b[off:], v)
+		return b
+	}
+	cases := map[string][]byte{
+		"magic":    patch(0, 0),
+		"version":  patch(8, ttFileVersion+1),
+		"seed":     patch(16, zobristSeed+1),
+		"side key": patch(24, zkey.side^1),
+		"size":     patch(32, uint64(len(tt.clusters)*2)),
+	}
+	for name, data := range cases {
+		fresh := NewTranTable(1)
+		fresh.store(clusterKey(2, 0), 9, MOVE_NONE, 4, TT_EXACT)
+		if err := fresh.Load(bytes.NewReader(data)); !errors.Is(err, ErrHashFile) {
+			t.Errorf("%s: got %v, want ErrHashFile", name, err)
+		}
+		if !fresh.has(clusterKey(2, 0)) {
+			t.Errorf("%s: rejected file changed the table", name)
+		}
+	}
+
+	other := NewTranTable(2)
+	if err := other.Load(bytes.NewReader(saved.Bytes())); !errors.Is(err, ErrHashFile) {
+		t.Errorf("loaded a 1 MB table into a 2 MB one: %v", err)
+	}
+	short := NewTranTable(1)
+	if err := short.Load(bytes.NewReader(saved.Bytes()[:saved.Len()-1])); err == nil {
+		t.Error("loaded a truncated file")
+	}
+}
@@ -5,5 +5,5 @@ package engine
 func init() {
 	// Reduce transposition table from 16MB to 2MB in Wasm builds
 	// to keep total memory usage reasonable in browsers.
-	TT = NewTranTable(2)
+	defaultHashSize = 2
 }
@@ -0,0 +1,160 @@
+package engine
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"unsafe"
+)
+
+// clusterKey returns the i-th key that maps to cluster c.
+func clusterKey(c, i int) Key {
+	return Key(c) | Key(i+1)<<48
+}
+
+func (tt *TransTable) has(key Key) bool {
+	_, ok := tt.probe(key)
+	return ok
+}
+
+func TestTTClusterFillsCacheLine(t *testing.T) {
+	if size := unsafe.Sizeof(ttCluster{}); size != 64 {
+		t.Errorf("cluster is %d bytes, want 64", size)
+	}
+}
+
+func TestTTStoreProbe(t *testing.T) {
+	tt := NewTranTable(1)
+	key := clusterKey(5, 0)
+	tt.store(key, -120, MakeMove(10, 19), 7, TT_BETA)
+	e, ok := tt.probe(key)
+	if !ok {
+		t.Fatal("stored entry not found")
+	}
+	if e.score != -120 || MoveNG(e.move) != MakeMove(10, 19) || e.depth() != 7 || e.bound() != TT_BETA {
+		t.Errorf("got %+v", e)
+	}
+	if tt.has(clusterKey(5, 1)) {
+		t.Error("found a position that was never stored")
+	}
+	if tt.has(clusterKey(6, 0)) {
+		t.Error("found an entry in the wrong cluster")
+	}
+}
+
+func TestTTReplacesShallowestEntry(t *testing.T) {
+	tt := NewTranTable(1)
+	for i := range clusterSize {
+		tt.store(clusterKey(0, i), 0, MOVE_NONE, uint8(10+i), TT_EXACT)
+	}
+	tt.store(clusterKey(0, clusterSize), 0, MOVE_NONE, 1, TT_ALPHA)
+	if tt.has(clusterKey(0, 0)) {
+		t.Error("shallowest entry survived")
+	}
+	for i := 1; i <= clusterSize; i++ {
+		if !tt.has(clusterKey(0, i)) {
+			t.Errorf("entry %d was evicted", i)
+		}
+	}
+}
+
+func TestTTPrefersEvictingOldSearches(t *testing.T) {
+	for _, c := range []struct {
+		oldDepth uint8
+		evicted  bool
+	}{
+		{14, true},  // as deep as the current entries, but older
+		{30, false}, // deep enough to outweigh its age
+	} {
+		tt := NewTranTable(1)
+		tt.store(clusterKey(0, 0), 0, MOVE_NONE, c.oldDepth, TT_EXACT)
+		tt.age++
+		for i := 1; i < clusterSize; i++ {
+			tt.store(clusterKey(0, i), 0, MOVE_NONE, 14, TT_EXACT)
+		}
+		tt.store(clusterKey(0, clusterSize), 0, MOVE_NONE, 3, TT_EXACT)
+		if evicted := !tt.has(clusterKey(0, 0)); evicted != c.evicted {
+			t.Errorf("old entry of depth %d: evicted %v, want %v", c.oldDepth, evicted, c.evicted)
+		}
+	}
+}
+
+func TestTTKeepsDeeperResultOfSamePosition(t *testing.T) {
+	tt := NewTranTable(1)
+	key := clusterKey(3, 0)
+	tt.store(key, 50, MakeMove(10, 19), 12, TT_EXACT)
+	tt.store(key, 10, MOVE_NONE, 2, TT_ALPHA)
+	if e, _ := tt.probe(key); e.depth() != 12 || e.score != 50 {
+		t.Errorf("shallow bound overwrote a deep exact entry: %+v", e)
+	}
+	tt.store(key, 10, MOVE_NONE, 11, TT_ALPHA)
+	e, _ := tt.probe(key)
+	if e.depth() != 11 || MoveNG(e.move) != MakeMove(10, 19) {
+		t.Errorf("got %+v, want depth 11 keeping the old move", e)
+	}
+}
+
+func TestTTHashfull(t *testing.T) {
+	tt := NewTranTable(1)
+	if got := tt.Hashfull(); got != 0 {
+		t.Errorf("empty table hashfull %d", got)
+	}
+	for c := range len(tt.clusters) {
+		for i := range clusterSize / 2 {
+			tt.store(clusterKey(c, i), 0, MOVE_NONE, 1, TT_EXACT)
+		}
+	}
+	if got := tt.Hashfull(); got != 500 {
+		t.Errorf("half full table hashfull %d, want 500", got)
+	}
+	tt.age++
+	if got := tt.Hashfull(); got != 0 {
+		t.Errorf("entries of the previous search counted: hashfull %d", got)
+	}
+	tt.Clear()
+	if tt.has(clusterKey(0, 0)) {
+		t.Error("entry survived Clear")
+	}
+}
+
+// TestTTConcurrentAccess hammers a few clusters from several goroutines.
+// Every key is always stored with the same score, move and depth, so a
+// reader that finds its key must see exactly those; run it with -race.
+func TestTTConcurrentAccess(t *testing.T) {
+	const (
+		workers = 8
+		keys    = 64
+		rounds  = 20000
+	)
+	tt := NewTranTable(1)
+	entryFor := func(k int) (Key, int16, MoveNG, uint8) {
+		return clusterKey(k%4, k), int16(k*7 - 200), MakeMove(k%90, (k+1)%90), uint8(k%20 + 1)
+	}
+	var wg sync.WaitGroup
+	errs := make(chan string, workers)
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range rounds {
+				k := (r*31 + w*17) % keys
+				key, score, move, depth := entryFor(k)
+				if r%3 == 0 {
+					tt.store(key, score, move, depth, TT_EXACT)
+					continue
+				}
+				e, ok := tt.probe(key)
+				if ok && (e.score != score || MoveNG(e.move) != move || e.depth() != depth || e.bound() != TT_EXACT) {
+					errs <- fmt.Sprintf("key %d: got %+v", k, e)
+					return
+				}
+				_ = tt.Hashfull()
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
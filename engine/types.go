@@ -128,14 +128,9 @@ const (
 	BishopValueEg  Value = 180
 )
 
-var PieceValue [PHASE_NB][PIECE_NB]Value = [PHASE_NB][PIECE_NB]Value{
-	{
-		VALUE_ZERO, RookValueMg, AdvisorValueMg, CannonValueMg, PawnValueMg, KnightValueMg, BishopValueMg, VALUE_ZERO, VALUE_ZERO, RookValueMg, AdvisorValueMg, CannonValueMg, PawnValueMg, KnightValueMg, BishopValueMg, VALUE_ZERO,
-	},
-	{
-		VALUE_ZERO, RookValueEg, AdvisorValueEg, CannonValueEg, PawnValueEg, KnightValueEg, BishopValueEg, VALUE_ZERO, VALUE_ZERO, RookValueEg, AdvisorValueEg, CannonValueEg, PawnValueEg, KnightValueEg, BishopValueEg, VALUE_ZERO,
-	},
-}
+// PieceValue is the value of every piece by phase under the built-in
+// weights, the constants above.
+var PieceValue = defaultEvalParams.pieceValueTable()
 
 // / A move needs 16 bits to be stored
 // /
@@ -0,0 +1,70 @@
+package engine
+
+import "testing"
+
+// The keys below must never change by accident: opening books and saved
+// hash tables depend on them. Update them only together with a deliberate
+// change of the Zobrist generator.
+func TestZobristGoldenKeys(t *testing.T) {
+	cases := []struct {
+		fen string
+		key Key
+	}{
+		{initialFen, 0xfbd6fe901ffb6d64},
+		{"rnbakabnr/9/1c5c1/p1p1p1p1p/9/9/P1P1P1P1P/1C5C1/9/RNBAKABNR b - - 0 1", 0x7d0a3e557c7c68dd},
+		{"rnbakabnr/9/1c5c1/p1p1p1p1p/9/9/P1P1P1P1P/1C2C4/9/RNBAKABNR b - - 1 1", 0xa859cc260519c154},
+		{"4ka3/4a4/4b4/9/9/2P6/9/9/4K4/5R3 w - - 0 1", 0xeecaeba26480ff5d},
+		{"3k5/9/9/9/9/9/9/9/9/4K4 w - - 0 1", 0xd62d3feaa791b3a5},
+	}
+	for _, c := range cases {
+		var pos PositionNG
+		if err := pos.Set(c.fen); err != nil {
+			t.Fatal(err)
+		}
+		if got := pos.Key(); got != c.key {
+			t.Errorf("%s: key %#016x, want %#016x", c.fen, got, c.key)
+		}
+	}
+}
+
+func TestKeyIsIndependentOfMoveOrderAndCounters(t *testing.T) {
+	var a, b PositionNG
+	if err := a.Set(initialFen); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Set(initialFen); err != nil {
+		t.Fatal(err)
+	}
+	var sa, sb [4]StateInfo
+	for i, m := range []string{"h2e2", "h9g7", "b0c2", "b9c7"} {
+		move, err := ParseUCIMove(&a, m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.DoMove(move, &sa[i])
+	}
+	for i, m := range []string{"b0c2", "b9c7", "h2e2", "h9g7"} {
+		move, err := ParseUCIMove(&b, m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.DoMove(move, &sb[i])
+	}
+	if a.Key() != b.Key() {
+		t.Errorf("transposition has different keys: %#016x and %#016x", a.Key(), b.Key())
+	}
+
+	// The key is a plain XOR of the piece-square keys and the side key.
+	var want Key
+	for s := SQ_A0; s <= SQ_I9; s++ {
+		if pc := a.Board[s]; pc != NO_PIECE {
+			want ^= zkey.psq[pc][s]
+		}
+	}
+	if a.SideToMove == BLACK {
+		want ^= zkey.side
+	}
+	if a.Key() != want {
+		t.Errorf("key %#016x, recomputed %#016x", a.Key(), want)
+	}
+}
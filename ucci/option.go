@@ -0,0 +1,338 @@
+package ucci
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hmgle/godogpaw/engine"
+)
+
+// Option types as defined by the UCCI specification.
+const (
+	optCheck  = "check"
+	optSpin   = "spin"
+	optCombo  = "combo"
+	optButton = "button"
+	optString = "string"
+	optLabel  = "label"
+)
+
+// option describes an engine parameter that a GUI can change with setoption.
+type option struct {
+	name    string
+	uciName string // name in the UCI dialect, empty if not offered there
+	typ     string
+	def     string
+	min     int
+	max     int
+	vars    []string
+	apply   func(p *Protocol, value string) error
+}
+
+// options lists every option advertised in reply to the ucci command, in
+// the order they are printed.
+var options = []*option{
+	{
+		name:    "hashsize",
+		uciName: "Hash",
+		typ:     optSpin,
+		def:     strconv.Itoa(engine.DefaultHashSize),
+		min:     engine.MinHashSize,
+		max:     engine.MaxHashSize,
+		apply:   setHashSize,
+	},
+	{
+		name:    "threads",
+		uciName: "Threads",
+		typ:     optSpin,
+		def:     "1",
+		min:     1,
+		max:     engine.MaxThreads,
+		apply:   setThreads,
+	},
+	{
+		name:    "multipv",
+		uciName: "MultiPV",
+		typ:     optSpin,
+		def:     "1",
+		min:     1,
+		max:     engine.MaxMultiPV,
+		apply:   setMultiPV,
+	},
+	{
+		name:    "usebook",
+		uciName: "OwnBook",
+		typ:     optCheck,
+		def:     "true",
+		apply:   setUseBook,
+	},
+	{
+		name:    "bookfiles",
+		uciName: "BookFile",
+		typ:     optString,
+		def:     noBook,
+		apply:   setBookFiles,
+	},
+	{
+		name:    "bookmode",
+		uciName: "BookMode",
+		typ:     optCombo,
+		def:     "weighted",
+		vars:    []string{"weighted", "best"},
+		apply:   setBookMode,
+	},
+	{
+		name:    "tbpath",
+		uciName: "TablebasePath",
+		typ:     optString,
+		def:     noTablebases,
+		apply:   setTablebasePath,
+	},
+	{
+		name:    "evalfile",
+		uciName: "EvalFile",
+		typ:     optString,
+		def:     noEvalFile,
+		apply:   setEvalFile,
+	},
+	{
+		name:    "ponder",
+		uciName: "Ponder",
+		typ:     optCheck,
+		def:     "false",
+		apply:   setPonder,
+	},
+	{
+		name:  "usemillisec",
+		typ:   optCheck,
+		def:   "false",
+		apply: setUseMillisec,
+	},
+	{
+		name:    "clearhash",
+		uciName: "Clear Hash",
+		typ:     optButton,
+		apply:   clearHash,
+	},
+	{
+		name:  "newgame",
+		typ:   optButton,
+		apply: newGame,
+	},
+}
+
+// findOption looks an option up by its UCCI or UCI name; both dialects
+// treat option names case-insensitively.
+func findOption(name string) *option {
+	for _, opt := range options {
+		if strings.EqualFold(opt.name, name) ||
+			(opt.uciName != "" && strings.EqualFold(opt.uciName, name)) {
+			return opt
+		}
+	}
+	return nil
+}
+
+// String formats the option as an "option" line of the ucci reply.
+func (opt *option) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "option %s type %s", opt.name, opt.typ)
+	if opt.typ == optSpin {
+		fmt.Fprintf(&sb, " min %d max %d", opt.min, opt.max)
+	}
+	for _, v := range opt.vars {
+		fmt.Fprintf(&sb, " var %s", v)
+	}
+	if opt.typ != optButton && opt.typ != optLabel {
+		fmt.Fprintf(&sb, " default %s", opt.def)
+	}
+	return sb.String()
+}
+
+// uciString formats the option as an "option" line of the uci reply.
+func (opt *option) uciString() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "option name %s type %s", opt.uciName, opt.typ)
+	if opt.typ != optButton {
+		fmt.Fprintf(&sb, " default %s", opt.def)
+	}
+	if opt.typ == optSpin {
+		fmt.Fprintf(&sb, " min %d max %d", opt.min, opt.max)
+	}
+	for _, v := range opt.vars {
+		fmt.Fprintf(&sb, " var %s", v)
+	}
+	return sb.String()
+}
+
+// set validates value against the option type and applies it.
+func (opt *option) set(p *Protocol, value string) error {
+	switch opt.typ {
+	case optCheck:
+		value = strings.ToLower(value)
+		if value != "true" && value != "false" {
+			return fmt.Errorf("%s expects true or false, got %q", opt.name, value)
+		}
+	case optSpin:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s expects an integer, got %q", opt.name, value)
+		}
+		if n < opt.min || n > opt.max {
+			return fmt.Errorf("%s out of range [%d, %d]: %d", opt.name, opt.min, opt.max, n)
+		}
+	case optCombo:
+		found := false
+		for _, v := range opt.vars {
+			if v == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s does not accept %q", opt.name, value)
+		}
+	}
+	return opt.apply(p, value)
+}
+
+func setHashSize(p *Protocol, value string) error {
+	mb, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	p.searcher.SetHashSize(mb)
+	return nil
+}
+
+func setThreads(p *Protocol, value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	p.searcher.SetThreads(n)
+	return nil
+}
+
+func setMultiPV(p *Protocol, value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	p.multiPV = n
+	return nil
+}
+
+// noBook is the bookfiles value that unloads the book.
+const noBook = "<empty>"
+
+func setUseBook(p *Protocol, value string) error {
+	p.useBook = value == "true"
+	p.updateBook()
+	return nil
+}
+
+// setBookFiles loads the books in a list of files separated by ';' as one
+// book.
+func setBookFiles(p *Protocol, value string) error {
+	if value == noBook {
+		p.book = nil
+		p.updateBook()
+		return nil
+	}
+	var entries []engine.BookEntry
+	for _, path := range strings.Split(value, ";") {
+		b, err := engine.OpenBook(strings.TrimSpace(path))
+		if err != nil {
+			return err
+		}
+		entries = append(entries, b.Entries()...)
+	}
+	p.book = engine.NewBook(entries)
+	p.updateBook()
+	return nil
+}
+
+func setBookMode(p *Protocol, value string) error {
+	p.bookMode = engine.BookWeighted
+	if value == "best" {
+		p.bookMode = engine.BookBest
+	}
+	p.updateBook()
+	return nil
+}
+
+// updateBook hands the book to the searcher if it is in use.
+func (p *Protocol) updateBook() {
+	if p.useBook {
+		p.searcher.SetBook(p.book, p.bookMode)
+	} else {
+		p.searcher.SetBook(nil, p.bookMode)
+	}
+}
+
+// noTablebases is the tbpath value that unloads the tablebases.
+const noTablebases = "<empty>"
+
+// setTablebasePath loads the tablebases of a directory.
+func setTablebasePath(p *Protocol, value string) error {
+	if value == noTablebases {
+		p.searcher.SetTablebases(nil)
+		return nil
+	}
+	tbs, err := engine.LoadTablebases(value)
+	if err != nil {
+		return err
+	}
+	if tbs.Len() == 0 {
+		return fmt.Errorf("no tablebases in %s", value)
+	}
+	p.searcher.SetTablebases(tbs)
+	return nil
+}
+
+// noEvalFile is the evalfile value that restores the built-in weights.
+const noEvalFile = "<empty>"
+
+// setEvalFile loads the evaluation weights of a JSON file. The current
+// position is set up again with them, and the hash table, filled with
+// scores of the old weights, is cleared.
+func setEvalFile(p *Protocol, value string) error {
+	params := engine.DefaultEvalParams()
+	if value != noEvalFile {
+		var err error
+		if params, err = engine.OpenEvalParams(value); err != nil {
+			return err
+		}
+	}
+	if err := engine.SetEvalParams(params); err != nil {
+		return err
+	}
+	enginePosition.SetState()
+	p.searcher.ClearHash()
+	return nil
+}
+
+func setPonder(p *Protocol, value string) error {
+	p.ponder = value == "true"
+	return nil
+}
+
+func setUseMillisec(p *Protocol, value string) error {
+	p.useMillisec = value == "true"
+	return nil
+}
+
+func clearHash(p *Protocol, value string) error {
+	p.searcher.ClearHash()
+	return nil
+}
+
+// newGame forgets the previous game: its hash entries, its banned moves
+// and its position.
+func newGame(p *Protocol, value string) error {
+	p.searcher.ClearHash()
+	p.banMoves = nil
+	return enginePosition.Set(engine.StartFEN)
+}
@@ -3,10 +3,13 @@ package ucci
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hmgle/godogpaw/engine"
@@ -15,147 +18,339 @@ import (
 
 type Protocol struct {
 	cmds map[string]func(p *Protocol, args []string)
+
+	// in holds the GUI commands and out takes the replies, written whole
+	// lines at a time under outMu since searches report concurrently.
+	in    io.Reader
+	out   io.Writer
+	outMu sync.Mutex
+
+	// dialect is chosen by the first handshake command, ucci or uci.
+	dialect dialect
+
+	// searcher runs the searches started by go.
+	searcher *engine.Searcher
+
+	// searchDone is closed once the running search has printed its
+	// bestmove; it is nil while the engine is idle.
+	searchDone chan struct{}
+	// stopCh is closed to tell the running search to finish.
+	stopCh chan struct{}
+	// ponderHitCh is closed on ponderhit; it is nil unless pondering.
+	ponderHitCh chan struct{}
+	// silent is set to drop the bestmove of the running search.
+	silent *atomic.Bool
+
+	// banMoves are the moves forbidden in the current position.
+	banMoves []engine.MoveNG
+
+	// useMillisec reports whether go clocks are in milliseconds.
+	useMillisec bool
+	// ponder reports whether the GUI may let us ponder.
+	ponder bool
+	// multiPV is the number of best lines reported while searching.
+	multiPV int
+
+	// book is the loaded opening book, nil if none; it is used only when
+	// useBook is set, picking moves with bookMode.
+	book     *engine.Book
+	useBook  bool
+	bookMode engine.BookMode
 }
 
+// NewProtocol returns a protocol reading commands from stdin and replying
+// on stdout.
 func NewProtocol() *Protocol {
-	p := &Protocol{}
+	return newProtocol(os.Stdin, os.Stdout)
+}
+
+func newProtocol(in io.Reader, out io.Writer) *Protocol {
+	p := &Protocol{in: in, out: out, searcher: engine.NewSearcher(), useBook: true}
+	p.searcher.SetReporter(func(i engine.Info) { p.sendLine("%s", i) })
 	p.cmds = map[string]func(p *Protocol, args []string){
-		"ucci":      ucciCmd,
-		"isready":   isReadyCmd,
-		"setoption": setOptionCmd,
-		"position":  positionCmd,
-		"banmoves":  banmovesCmd,
-		"go":        goCmd,
-		"ponderhit": ponderhitCmd,
-		"stop":      stopCmd,
-		"perft":     perftCmd,
+		"ucci":       ucciCmd,
+		"uci":        uciCmd,
+		"ucinewgame": uciNewGameCmd,
+		"isready":    isReadyCmd,
+		"setoption":  setOptionCmd,
+		"position":   positionCmd,
+		"banmoves":   banmovesCmd,
+		"go":         goCmd,
+		"ponderhit":  ponderhitCmd,
+		"stop":       stopCmd,
+		"perft":      perftCmd,
+		"bench":      benchCmd,
+		"eval":       evalCmd,
+		"saveeval":   saveEvalCmd,
+		"savehash":   saveHashCmd,
+		"loadhash":   loadHashCmd,
+	}
+	// Searching before the first position command uses the start position.
+	if err := enginePosition.Set(engine.StartFEN); err != nil {
+		panic(err)
 	}
 	return p
 }
 
-func sendLine(format string, args ...interface{}) {
+func (p *Protocol) sendLine(format string, args ...interface{}) {
 	line := fmt.Sprintf(format, args...)
 	logrus.WithFields(logrus.Fields{
 		"direction": "out",
 		"payload":   line,
 	}).Debug("ucci reply")
-	fmt.Println(line)
+	p.outMu.Lock()
+	defer p.outMu.Unlock()
+	fmt.Fprintln(p.out, line)
 }
 
 func stopCmd(p *Protocol, args []string) {
-	engine.StopSearch()
+	p.stopSearch()
+}
+
+// stopSearch aborts the running search, if any, and waits until its
+// bestmove has been sent.
+func (p *Protocol) stopSearch() {
+	p.endSearch(true)
+}
+
+// endSearch aborts the running search, if any, and waits for it to end;
+// its bestmove is sent only if report is set.
+func (p *Protocol) endSearch(report bool) {
+	if p.searchDone == nil {
+		return
+	}
+	if !report {
+		p.silent.Store(true)
+	}
+	close(p.stopCh)
+	p.searcher.Stop()
+	<-p.searchDone
+	p.searchDone = nil
+	p.stopCh = nil
+	p.ponderHitCh = nil
+	p.silent = nil
 }
 
+// startSearch launches a search on its own goroutine so the command loop
+// keeps reading stdin while the engine thinks.
+func (p *Protocol) startSearch(limits engine.SearchLimits) {
+	p.stopSearch()
+	done := make(chan struct{})
+	stop := make(chan struct{})
+	var ponderHit chan struct{}
+	if limits.Ponder {
+		ponderHit = make(chan struct{})
+	}
+	silent := new(atomic.Bool)
+	p.searchDone = done
+	p.stopCh = stop
+	p.ponderHitCh = ponderHit
+	p.silent = silent
+	d := p.dialect
+	result := p.searcher.Start(&enginePosition, limits)
+	go func() {
+		defer close(done)
+		res := <-result
+		// An infinite or ponder search must not report before the GUI
+		// says stop (or ponderhit).
+		if limits.Infinite {
+			<-stop
+		} else if limits.Ponder {
+			select {
+			case <-stop:
+			case <-ponderHit:
+			}
+		}
+		if !silent.Load() {
+			p.sendBestMove(d, res)
+		}
+	}()
+}
+
+func (p *Protocol) sendBestMove(d dialect, res engine.SearchResult) {
+	if !engine.IsOKMove(res.BestMove) {
+		if d == dialectUCI {
+			p.sendLine("bestmove 0000")
+		} else {
+			p.sendLine("nobestmove")
+		}
+		return
+	}
+	logrus.WithFields(logrus.Fields{
+		"direction": "out",
+		"command":   "bestmove",
+		"move":      engine.Move2Str(res.BestMove),
+	}).Debug("computed move")
+	if engine.IsOKMove(res.PonderMove) {
+		p.sendLine("bestmove %s ponder %s", engine.Move2Str(res.BestMove), engine.Move2Str(res.PonderMove))
+		return
+	}
+	p.sendLine("bestmove %s", engine.Move2Str(res.BestMove))
+}
+
+// 格式：ponderhit [draw]
 func ponderhitCmd(p *Protocol, args []string) {
-	// TODO
+	if p.ponderHitCh == nil {
+		return
+	}
+	p.searcher.PonderHit()
+	close(p.ponderHitCh)
+	p.ponderHitCh = nil
 }
 
+// 格式：go [ponder | draw] [searchmoves <着法列表>] <思考模式>
+// 思考模式：depth <d> | nodes <n> | mate <n> | time <t> [increment <i> | movestogo <n>]
+// [opptime <t> [oppincrement <i> | oppmovestogo <n>]] | movetime <t> | infinite
 func goCmd(p *Protocol, args []string) {
-	limits := engine.SearchLimits{}
+	p.stopSearch()
+	limits := engine.SearchLimits{BanMoves: p.banMoves, MultiPV: p.multiPV}
+	var tc engine.TimeControl
+	hasClock := false
 
 	// Parse arguments
 	for i := 0; i < len(args); i++ {
 		switch args[i] {
-		case "depth":
-			if i+1 < len(args) {
-				d, err := strconv.Atoi(args[i+1])
-				if err != nil {
-					log.Printf("invalid depth: %s", args[i+1])
-					return
-				}
-				limits.Depth = uint8(d)
+		case "infinite":
+			limits.Infinite = true
+			continue
+		case "ponder":
+			limits.Ponder = true
+			continue
+		case "draw":
+			continue
+		case "searchmoves":
+			for i+1 < len(args) && !goKeywords[args[i+1]] {
 				i++
-			}
-		case "movetime":
-			if i+1 < len(args) {
-				ms, err := strconv.Atoi(args[i+1])
+				move, err := engine.ParseUCIMove(&enginePosition, args[i])
 				if err != nil {
-					log.Printf("invalid movetime: %s", args[i+1])
-					return
+					p.sendLine("info string invalid search move %s: %v", args[i], err)
+					continue
 				}
-				limits.TimeLimit = time.Duration(ms) * time.Millisecond
-				i++
+				limits.SearchMoves = append(limits.SearchMoves, move)
 			}
-		case "wtime":
-			if i+1 < len(args) {
-				ms, err := strconv.Atoi(args[i+1])
-				if err == nil && enginePosition.SideToMove == engine.WHITE {
-					limits.TimeLimit = allocateTime(ms, 0, args)
-				}
-				i++
+			continue
+		}
+		if !goKeywords[args[i]] {
+			log.Printf("go: ignoring %s", args[i])
+			continue
+		}
+		if i+1 >= len(args) {
+			p.sendLine("info string go: missing value for %s", args[i])
+			return
+		}
+		n, err := strconv.Atoi(args[i+1])
+		if err != nil || n < 0 || (n == 0 && args[i] == "depth") {
+			p.sendLine("info string go: invalid %s %s", args[i], args[i+1])
+			return
+		}
+		i++
+		switch args[i-1] {
+		case "depth":
+			limits.Depth = uint8(min(n, 255))
+		case "nodes":
+			limits.Nodes = n
+		case "mate":
+			limits.Mate = n
+		case "movetime":
+			limits.TimeLimit = time.Duration(n) * time.Millisecond
+		case "time":
+			tc.Time = p.timeUnit(n)
+			hasClock = true
+		case "increment":
+			tc.Increment = p.timeUnit(n)
+		case "movestogo":
+			tc.MovesToGo = n
+		case "opptime":
+			tc.OppTime = p.timeUnit(n)
+		case "oppincrement":
+			tc.OppIncrement = p.timeUnit(n)
+		case "oppmovestogo":
+			tc.OppMovesToGo = n
+		case "wtime", "btime":
+			ms := time.Duration(n) * time.Millisecond
+			if (args[i-1] == "wtime") == (enginePosition.SideToMove == engine.WHITE) {
+				tc.Time = ms
+				hasClock = true
+			} else {
+				tc.OppTime = ms
 			}
-		case "btime":
-			if i+1 < len(args) {
-				ms, err := strconv.Atoi(args[i+1])
-				if err == nil && enginePosition.SideToMove == engine.BLACK {
-					limits.TimeLimit = allocateTime(ms, 0, args)
-				}
-				i++
+		case "winc", "binc":
+			ms := time.Duration(n) * time.Millisecond
+			if (args[i-1] == "winc") == (enginePosition.SideToMove == engine.WHITE) {
+				tc.Increment = ms
+			} else {
+				tc.OppIncrement = ms
 			}
-		case "infinite":
-			limits.Infinite = true
 		}
 	}
+	tc.Ponder = p.ponder
+	if hasClock && limits.TimeLimit == 0 {
+		limits.SoftTime, limits.TimeLimit = tc.Budget()
+	}
+	// A ponder search without a clock must still answer after ponderhit.
+	if limits.Ponder && limits.TimeLimit == 0 && limits.Depth == 0 && limits.Nodes == 0 && limits.Mate == 0 {
+		limits.TimeLimit = ponderHitTime
+	}
 
 	// Default: if no depth or time, use depth 4 as fallback
-	if limits.Depth == 0 && limits.TimeLimit == 0 && !limits.Infinite {
+	if limits.Depth == 0 && limits.TimeLimit == 0 && limits.Nodes == 0 && limits.Mate == 0 &&
+		!limits.Infinite && !limits.Ponder {
 		limits.Depth = 4
 	}
 
-	bestMov := enginePosition.SearchPositionWithLimits(limits)
-	logrus.WithFields(logrus.Fields{
-		"direction": "out",
-		"command":   "bestmove",
-		"move":      engine.Move2Str(bestMov),
-	}).Debug("computed move")
-	sendLine("bestmove %s", engine.Move2Str(bestMov))
+	p.startSearch(limits)
 }
 
-// allocateTime calculates how much time to spend on this move.
-func allocateTime(remainingMs int, incrementMs int, args []string) time.Duration {
-	// Parse increment if present
-	for i := 0; i < len(args)-1; i++ {
-		if args[i] == "winc" || args[i] == "binc" {
-			inc, err := strconv.Atoi(args[i+1])
-			if err == nil {
-				incrementMs = inc
-			}
-		}
-	}
+// ponderHitTime is the time to think after ponderhit when go ponder gave
+// no clock.
+const ponderHitTime = time.Second
 
-	// Allocate time: remaining/30 + increment, with safety margin
-	allocated := remainingMs/30 + incrementMs
-	// Don't use more than 80% of remaining time
-	maxTime := remainingMs * 80 / 100
-	if allocated > maxTime {
-		allocated = maxTime
-	}
-	// Minimum 100ms
-	if allocated < 100 {
-		allocated = 100
-	}
+// goKeywords are the tokens of the go command that end a searchmoves list.
+var goKeywords = map[string]bool{
+	"ponder": true, "draw": true, "infinite": true, "searchmoves": true,
+	"depth": true, "nodes": true, "mate": true, "movetime": true,
+	"time": true, "increment": true, "movestogo": true,
+	"opptime": true, "oppincrement": true, "oppmovestogo": true,
+	"wtime": true, "btime": true, "winc": true, "binc": true,
+}
 
-	return time.Duration(allocated) * time.Millisecond
+// timeUnit converts a UCCI clock value, which is in seconds unless the GUI
+// enabled usemillisec.
+func (p *Protocol) timeUnit(n int) time.Duration {
+	if p.useMillisec {
+		return time.Duration(n) * time.Millisecond
+	}
+	return time.Duration(n) * time.Second
 }
 
+// 格式：banmoves <禁止着法列表>
 func banmovesCmd(p *Protocol, args []string) {
-	// TODO
+	p.stopSearch()
+	p.banMoves = p.banMoves[:0]
+	for _, mv := range args {
+		move, err := engine.ParseUCIMove(&enginePosition, mv)
+		if err != nil {
+			p.sendLine("info string invalid banned move %s: %v", mv, err)
+			continue
+		}
+		p.banMoves = append(p.banMoves, move)
+	}
 }
 
-const initFen = "rnbakabnr/9/1c5c1/p1p1p1p1p/9/9/P1P1P1P1P/1C5C1/9/RNBAKABNR w - - 0 1"
-
 var enginePosition engine.PositionNG
 
 // 格式：position {fen <FEN串> | startpos} [moves <后续着法列表>]
 func positionCmd(p *Protocol, args []string) {
+	p.stopSearch()
+	p.banMoves = nil
 	if len(args) == 0 {
-		log.Printf("position command missing arguments")
+		p.sendLine("info string position missing arguments")
 		return
 	}
 	var fen string
 	movesIndex := findIndexString(args, "moves")
 	if args[0] == "startpos" {
-		fen = initFen
+		fen = engine.StartFEN
 	} else if args[0] == "fen" {
 		if movesIndex == -1 {
 			fen = strings.Join(args[1:], " ")
@@ -163,14 +358,18 @@ func positionCmd(p *Protocol, args []string) {
 			fen = strings.Join(args[1:movesIndex], " ")
 		}
 	} else {
-		log.Fatalf("bad fen: %v", args)
+		p.sendLine("info string position expects startpos or fen, got %s", args[0])
+		return
+	}
+	if err := enginePosition.Set(fen); err != nil {
+		p.sendLine("info string %v", err)
+		return
 	}
-	enginePosition.Set(fen)
 	if movesIndex >= 0 {
 		for _, mv := range args[movesIndex+1:] {
 			move, err := engine.ParseUCIMove(&enginePosition, mv)
 			if err != nil {
-				sendLine("info string invalid move %s: %v", mv, err)
+				p.sendLine("info string invalid move %s: %v", mv, err)
 				return
 			}
 			var st engine.StateInfo
@@ -179,17 +378,18 @@ func positionCmd(p *Protocol, args []string) {
 	}
 	isOk := enginePosition.PosIsOk()
 	log.Printf("fen: %s, p.PosIsOk: %+v, eval: %d, red_ksq: %d, black_ksq: %d\n",
-		fen, isOk, enginePosition.Evaluate(), enginePosition.KingSQ[engine.WHITE], enginePosition.KingSQ[engine.BLACK])
+		enginePosition.FEN(), isOk, enginePosition.Evaluate(), enginePosition.KingSQ[engine.WHITE], enginePosition.KingSQ[engine.BLACK])
 }
 
 func perftCmd(p *Protocol, args []string) {
+	p.stopSearch()
 	if len(args) == 0 {
-		sendLine("info string usage: perft <depth>")
+		p.sendLine("info string usage: perft <depth>")
 		return
 	}
 	depth, err := strconv.Atoi(args[0])
 	if err != nil || depth < 0 {
-		sendLine("info string invalid depth %s", args[0])
+		p.sendLine("info string invalid depth %s", args[0])
 		return
 	}
 	start := time.Now()
@@ -199,8 +399,95 @@ func perftCmd(p *Protocol, args []string) {
 	if elapsed > 0 {
 		nps = int(float64(nodes) / elapsed.Seconds())
 	}
-	sendLine("info string perft depth %d nodes %d time %dms nps %d", depth, nodes, elapsed.Milliseconds(), nps)
-	sendLine("perft %d", nodes)
+	p.sendLine("info string perft depth %d nodes %d time %dms nps %d", depth, nodes, elapsed.Milliseconds(), nps)
+	p.sendLine("perft %d", nodes)
+}
+
+// 格式：bench [<深度> [<置换表大小>]]
+func benchCmd(p *Protocol, args []string) {
+	p.stopSearch()
+	depth, hashMB := 8, engine.DefaultHashSize
+	for i, v := range []*int{&depth, &hashMB} {
+		if i >= len(args) {
+			break
+		}
+		n, err := strconv.Atoi(args[i])
+		if err != nil || n <= 0 {
+			p.sendLine("info string usage: bench [depth [hashsize]]")
+			return
+		}
+		*v = n
+	}
+	var nodes int
+	var elapsed time.Duration
+	for i, r := range engine.Bench(uint8(min(depth, 255)), hashMB) {
+		p.sendLine("info string bench position %d nodes %d time %dms", i+1, r.Nodes, r.Time.Milliseconds())
+		nodes += r.Nodes
+		elapsed += r.Time
+	}
+	nps := 0
+	if elapsed > 0 {
+		nps = int(float64(nodes) / elapsed.Seconds())
+	}
+	p.sendLine("info string bench depth %d nodes %d time %dms nps %d", depth, nodes, elapsed.Milliseconds(), nps)
+}
+
+// 格式：eval
+func evalCmd(p *Protocol, args []string) {
+	p.stopSearch()
+	tr := enginePosition.EvaluateTrace()
+	for _, line := range strings.Split(strings.TrimSuffix(tr.String(), "\n"), "\n") {
+		p.sendLine("info string %s", line)
+	}
+}
+
+// 格式：saveeval <文件名>
+func saveEvalCmd(p *Protocol, args []string) {
+	p.stopSearch()
+	if len(args) == 0 {
+		p.sendLine("info string usage: saveeval <file>")
+		return
+	}
+	if err := saveEval(strings.Join(args, " ")); err != nil {
+		p.sendLine("info string saveeval: %v", err)
+	}
+}
+
+// saveEval writes the evaluation weights in use to the named file.
+func saveEval(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := engine.CurrentEvalParams().Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// 格式：savehash <文件名>
+func saveHashCmd(p *Protocol, args []string) {
+	p.stopSearch()
+	if len(args) == 0 {
+		p.sendLine("info string usage: savehash <file>")
+		return
+	}
+	if err := p.searcher.SaveHash(strings.Join(args, " ")); err != nil {
+		p.sendLine("info string savehash: %v", err)
+	}
+}
+
+// 格式：loadhash <文件名>
+func loadHashCmd(p *Protocol, args []string) {
+	p.stopSearch()
+	if len(args) == 0 {
+		p.sendLine("info string usage: loadhash <file>")
+		return
+	}
+	if err := p.searcher.LoadHash(strings.Join(args, " ")); err != nil {
+		p.sendLine("info string loadhash: %v", err)
+	}
 }
 
 func findIndexString(slice []string, value string) int {
@@ -212,23 +499,69 @@ func findIndexString(slice []string, value string) int {
 	return -1
 }
 
+// 格式：setoption <选项> [<值>]
+// UCI 格式：setoption name <id> [value <x>]
 func setOptionCmd(p *Protocol, args []string) {
-	// TODO
+	p.stopSearch()
+	if len(args) == 0 {
+		p.sendLine("info string setoption missing option name")
+		return
+	}
+	name, value := args[0], strings.Join(args[1:], " ")
+	if args[0] == "name" {
+		valueIndex := findIndexString(args, "value")
+		if valueIndex == -1 {
+			name, value = strings.Join(args[1:], " "), ""
+		} else {
+			name, value = strings.Join(args[1:valueIndex], " "), strings.Join(args[valueIndex+1:], " ")
+		}
+	}
+	opt := findOption(name)
+	if opt == nil {
+		p.sendLine("info string unknown option %s", name)
+		return
+	}
+	if value == "" && opt.typ != optButton {
+		p.sendLine("info string option %s requires a value", opt.name)
+		return
+	}
+	if err := opt.set(p, value); err != nil {
+		p.sendLine("info string %v", err)
+		return
+	}
+	logrus.WithFields(logrus.Fields{
+		"option": opt.name,
+		"value":  value,
+	}).Debug("option set")
 }
 
 func isReadyCmd(p *Protocol, args []string) {
-	sendLine("readyok")
+	p.sendLine("readyok")
 }
 
 func ucciCmd(p *Protocol, args []string) {
-	sendLine("ucciok")
+	p.dialect = dialectUCCI
+	p.sendLine("id name godogpaw")
+	p.sendLine("id author hmgle")
+	for _, opt := range options {
+		p.sendLine("%s", opt)
+	}
+	p.sendLine("ucciok")
 }
 
+// Run serves the commands until quit or the end of the input. Quitting
+// drops the bestmove of a running search, and UCCI acknowledges it with
+// bye.
 func (p *Protocol) Run() {
-	scanner := bufio.NewScanner(os.Stdin)
+	scanner := bufio.NewScanner(p.in)
+	defer p.stopSearch()
 	for scanner.Scan() {
 		cmdLine := scanner.Text()
-		if cmdLine == "quit" {
+		if strings.TrimSpace(cmdLine) == "quit" {
+			p.endSearch(false)
+			if p.dialect == dialectUCCI {
+				p.sendLine("bye")
+			}
 			return
 		}
 		logrus.WithFields(logrus.Fields{
@@ -236,11 +569,14 @@ func (p *Protocol) Run() {
 			"payload":   cmdLine,
 		}).Debug("ucci recv")
 		cmdArgs := strings.Fields(cmdLine)
+		if len(cmdArgs) == 0 {
+			continue
+		}
 		cmd, ok := p.cmds[cmdArgs[0]]
 		if ok {
 			cmd(p, cmdArgs[1:])
 		} else {
-			log.Fatalln("bad cmd:", cmdLine)
+			p.sendLine("info string unknown command: %s", cmdLine)
 		}
 	}
 }
@@ -0,0 +1,493 @@
+package ucci
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hmgle/godogpaw/engine"
+)
+
+// session drives a Protocol through pipes, one command at a time.
+type session struct {
+	t     *testing.T
+	p     *Protocol
+	in    *io.PipeWriter
+	lines chan string
+	done  chan struct{}
+}
+
+func newSession(t *testing.T) *session {
+	t.Helper()
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	s := &session{
+		t:     t,
+		p:     newProtocol(inR, outW),
+		in:    inW,
+		lines: make(chan string, 1<<16),
+		done:  make(chan struct{}),
+	}
+	go func() {
+		s.p.Run()
+		outW.Close()
+		close(s.done)
+	}()
+	go func() {
+		defer close(s.lines)
+		scanner := bufio.NewScanner(outR)
+		for scanner.Scan() {
+			s.lines <- scanner.Text()
+		}
+	}()
+	t.Cleanup(s.close)
+	s.send("setoption hashsize 1")
+	return s
+}
+
+func (s *session) send(cmds ...string) {
+	for _, cmd := range cmds {
+		if _, err := io.WriteString(s.in, cmd+"\n"); err != nil {
+			s.t.Fatalf("send %q: %v", cmd, err)
+		}
+	}
+}
+
+// expect reads replies up to the first one starting with prefix and
+// returns it with the replies before it.
+func (s *session) expect(prefix string) (string, []string) {
+	s.t.Helper()
+	var skipped []string
+	timeout := time.After(20 * time.Second)
+	for {
+		select {
+		case line, ok := <-s.lines:
+			if !ok {
+				s.t.Fatalf("no reply %q before the end, got %q", prefix, skipped)
+			}
+			if strings.HasPrefix(line, prefix) {
+				return line, skipped
+			}
+			skipped = append(skipped, line)
+		case <-timeout:
+			s.t.Fatalf("no reply %q in time, got %q", prefix, skipped)
+		}
+	}
+}
+
+// rest ends the input and returns the remaining replies.
+func (s *session) rest() []string {
+	s.in.Close()
+	<-s.done
+	var lines []string
+	for line := range s.lines {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func (s *session) close() {
+	s.in.Close()
+	<-s.done
+}
+
+func hasPrefix(lines []string, prefix string) bool {
+	for _, line := range lines {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// bestMove waits for the bestmove reply and returns its move.
+func (s *session) bestMove() string {
+	s.t.Helper()
+	line, _ := s.expect("bestmove ")
+	return strings.Fields(line)[1]
+}
+
+func TestUCCIHandshake(t *testing.T) {
+	s := newSession(t)
+	s.send("ucci")
+	if _, lines := s.expect("ucciok"); !hasPrefix(lines, "option hashsize type spin") || !hasPrefix(lines, "id name godogpaw") {
+		t.Errorf("ucci reply %q", lines)
+	}
+	s.send("isready")
+	s.expect("readyok")
+}
+
+func TestSetOption(t *testing.T) {
+	s := newSession(t)
+	for cmd, want := range map[string]string{
+		"setoption":            "info string setoption missing option name",
+		"setoption hashsize 0": "info string hashsize out of range",
+		"setoption hashsize":   "info string option hashsize requires a value",
+		"setoption nosuch 1":   "info string unknown option nosuch",
+	} {
+		s.send(cmd, "isready")
+		if _, lines := s.expect("readyok"); !hasPrefix(lines, want) {
+			t.Errorf("%s: replied %q, want %q", cmd, lines, want)
+		}
+	}
+	for _, cmd := range []string{
+		"setoption hashsize 2",
+		"setoption clearhash",
+		"setoption newgame",
+	} {
+		s.send(cmd, "isready")
+		if _, lines := s.expect("readyok"); len(lines) != 0 {
+			t.Errorf("%s: replied %q", cmd, lines)
+		}
+	}
+}
+
+func TestSearchInBackground(t *testing.T) {
+	s := newSession(t)
+	s.send("position startpos", "go infinite", "isready")
+	if _, lines := s.expect("readyok"); hasPrefix(lines, "bestmove") {
+		t.Errorf("infinite search reported before stop: %q", lines)
+	}
+	s.send("stop")
+	s.bestMove()
+
+	// A new go stops the running search first.
+	s.send("go infinite", "go depth 2")
+	s.bestMove()
+	s.bestMove()
+}
+
+func TestQuit(t *testing.T) {
+	s := newSession(t)
+	s.send("ucci")
+	s.expect("ucciok")
+
+	// Quitting in the middle of a search drops its bestmove.
+	s.send("go infinite", "quit")
+	lines := s.rest()
+	if hasPrefix(lines, "bestmove") || len(lines) == 0 || lines[len(lines)-1] != "bye" {
+		t.Errorf("quit while searching replied %q, want bye only", lines)
+	}
+}
+
+func TestPonder(t *testing.T) {
+	s := newSession(t)
+	s.send("position startpos")
+
+	// The ponder search waits for ponderhit, then plays within its time.
+	s.send("go ponder movetime 300", "isready")
+	if _, lines := s.expect("readyok"); hasPrefix(lines, "bestmove") {
+		t.Errorf("ponder search reported before ponderhit: %q", lines)
+	}
+	s.send("ponderhit")
+	if line, _ := s.expect("bestmove "); !strings.Contains(line, " ponder ") {
+		t.Errorf("got %q, want a ponder move", line)
+	}
+
+	// A ponderhit right after go starts the clock all the same.
+	s.send("go ponder movetime 300", "ponderhit")
+	s.bestMove()
+
+	// Stop ends pondering on a move the opponent did not play.
+	s.send("go ponder movetime 300", "stop")
+	s.bestMove()
+
+	// Without a clock the search thinks a fixed time after ponderhit.
+	s.send("go ponder", "isready")
+	if _, lines := s.expect("readyok"); hasPrefix(lines, "bestmove") {
+		t.Errorf("ponder search reported before ponderhit: %q", lines)
+	}
+	s.send("ponderhit")
+	s.bestMove()
+
+	// A ponderhit without a ponder search is ignored.
+	s.send("ponderhit", "isready")
+	if _, lines := s.expect("readyok"); len(lines) != 0 {
+		t.Errorf("stray ponderhit replied %q", lines)
+	}
+}
+
+func TestBanMoves(t *testing.T) {
+	s := newSession(t)
+	s.send("position startpos", "go depth 3")
+	first := s.bestMove()
+
+	// banmoves applies to the position it follows.
+	s.send("position startpos", "banmoves "+first, "go depth 3")
+	if m := s.bestMove(); m == first {
+		t.Errorf("played the banned move %s", m)
+	}
+
+	s.send("banmoves a0a5", "isready")
+	if _, lines := s.expect("readyok"); !hasPrefix(lines, "info string invalid banned move a0a5") {
+		t.Errorf("banmoves a0a5 replied %q", lines)
+	}
+}
+
+func TestNewGameForgetsBannedMoves(t *testing.T) {
+	p := newProtocol(strings.NewReader(""), io.Discard)
+	banmovesCmd(p, []string{"h2e2"})
+	if len(p.banMoves) != 1 {
+		t.Fatalf("banned %d moves, want 1", len(p.banMoves))
+	}
+	if err := newGame(p, ""); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.banMoves) != 0 {
+		t.Errorf("newgame kept banned moves %v", p.banMoves)
+	}
+}
+
+func TestClock(t *testing.T) {
+	s := newSession(t)
+	for cmd, want := range map[string]string{
+		"setoption usemillisec maybe": "info string usemillisec expects true or false",
+		"go depth x":                  "info string go: invalid depth x",
+		"go time":                     "info string go: missing value for time",
+	} {
+		s.send(cmd, "isready")
+		if _, lines := s.expect("readyok"); !hasPrefix(lines, want) {
+			t.Errorf("%s: replied %q, want %q", cmd, lines, want)
+		}
+	}
+
+	// Clocks are in seconds unless usemillisec is set; a short clock
+	// ends the search without stop.
+	s.send("position startpos", "setoption usemillisec true", "go time 300 increment 0 opptime 300")
+	s.bestMove()
+	s.send("setoption ponder true", "go ponder time 500 opptime 500", "isready")
+	if _, lines := s.expect("readyok"); hasPrefix(lines, "bestmove") {
+		t.Errorf("ponder search reported before ponderhit: %q", lines)
+	}
+	s.send("ponderhit")
+	s.bestMove()
+}
+
+func TestPositionAndPerft(t *testing.T) {
+	s := newSession(t)
+	s.send("position startpos moves h2e2 h9g7", "perft 2")
+	line, _ := s.expect("perft ")
+	var pos engine.PositionNG
+	if err := pos.Set(engine.StartFEN); err != nil {
+		t.Fatal(err)
+	}
+	for _, mv := range []string{"h2e2", "h9g7"} {
+		m, err := engine.ParseUCIMove(&pos, mv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var st engine.StateInfo
+		pos.DoMove(m, &st)
+	}
+	if want := "perft " + strconv.FormatUint(uint64(pos.Perft(2, false)), 10); line != want {
+		t.Errorf("got %q, want %q", line, want)
+	}
+
+	// Malformed commands are reported and leave the engine running.
+	for cmd, want := range map[string]string{
+		"position":                       "info string position missing arguments",
+		"position somewhere":             "info string position expects startpos or fen",
+		"position fen 9/9/9 w - - 0 1":   "info string",
+		"position startpos moves a0a5":   "info string invalid move a0a5",
+		"position startpos moves h2e2 x": "info string invalid move x",
+		"perft many":                     "info string invalid depth many",
+		"frobnicate":                     "info string unknown command: frobnicate",
+	} {
+		s.send(cmd, "isready")
+		if _, lines := s.expect("readyok"); !hasPrefix(lines, want) {
+			t.Errorf("%s: replied %q, want %q", cmd, lines, want)
+		}
+	}
+}
+
+func TestThreads(t *testing.T) {
+	s := newSession(t)
+	for cmd, want := range map[string]string{
+		"setoption threads two": "info string threads expects an integer",
+		"setoption threads 0":   "info string threads out of range",
+	} {
+		s.send(cmd, "isready")
+		if _, lines := s.expect("readyok"); !hasPrefix(lines, want) {
+			t.Errorf("%s: replied %q, want %q", cmd, lines, want)
+		}
+	}
+	s.send("setoption threads 4", "isready")
+	if _, lines := s.expect("readyok"); len(lines) != 0 {
+		t.Errorf("setoption threads 4 replied %q", lines)
+	}
+
+	// The helper threads stop with the main one.
+	s.send("position startpos", "go depth 4")
+	s.bestMove()
+	s.send("go infinite", "stop")
+	s.bestMove()
+}
+
+func TestNodesAndMate(t *testing.T) {
+	s := newSession(t)
+	s.send("position startpos", "go nodes 2000")
+	s.bestMove()
+	s.send("position fen 9/9/4k4/9/9/9/9/9/9/R2K5 w - - 0 1", "go mate 2")
+	if m := s.bestMove(); m != "a0a8" {
+		t.Errorf("mate search played %s, want a0a8", m)
+	}
+}
+
+func TestGoArguments(t *testing.T) {
+	s := newSession(t)
+	s.send("position startpos")
+
+	// An unknown token does not take the next one with it.
+	s.send("go wait nodes 2000 somelabel")
+	s.bestMove()
+
+	s.send("go depth 0", "isready")
+	if _, lines := s.expect("readyok"); !hasPrefix(lines, "info string go: invalid depth 0") || hasPrefix(lines, "bestmove") {
+		t.Errorf("go depth 0 replied %q", lines)
+	}
+}
+
+func TestSearchMoves(t *testing.T) {
+	s := newSession(t)
+	s.send("position startpos", "go depth 2 searchmoves b2b9 h0g2")
+	if m := s.bestMove(); m != "b2b9" && m != "h0g2" {
+		t.Errorf("searchmoves b2b9 h0g2 played %s", m)
+	}
+	s.send("position startpos moves h2e2", "go depth 1 searchmoves b7b0")
+	if m := s.bestMove(); m != "b7b0" {
+		t.Errorf("searchmoves b7b0 played %s", m)
+	}
+	s.send("go depth 1 searchmoves a0a5 h9g7")
+	line, lines := s.expect("bestmove ")
+	if !hasPrefix(lines, "info string invalid search move a0a5") || strings.Fields(line)[1] != "h9g7" {
+		t.Errorf("searchmoves a0a5 h9g7 replied %q then %q", lines, line)
+	}
+}
+
+func TestBench(t *testing.T) {
+	s := newSession(t)
+	s.send("bench 1")
+	if _, lines := s.expect("info string bench depth 1 nodes "); !hasPrefix(lines, "info string bench position 1 nodes ") {
+		t.Errorf("bench replied %q", lines)
+	}
+	s.send("bench deep", "isready")
+	if _, lines := s.expect("readyok"); !hasPrefix(lines, "info string usage: bench [depth [hashsize]]") {
+		t.Errorf("bench deep replied %q", lines)
+	}
+}
+
+func TestSaveAndLoadHash(t *testing.T) {
+	hash := filepath.Join(t.TempDir(), "hash")
+	s := newSession(t)
+	s.send("position startpos", "go depth 2")
+	s.bestMove()
+	s.send("savehash "+hash, "loadhash "+hash, "isready")
+	if _, lines := s.expect("readyok"); len(lines) != 0 {
+		t.Errorf("savehash and loadhash replied %q", lines)
+	}
+	if _, err := os.Stat(hash); err != nil {
+		t.Error(err)
+	}
+	for cmd, want := range map[string]string{
+		"savehash":                 "info string usage: savehash <file>",
+		"loadhash":                 "info string usage: loadhash <file>",
+		"loadhash /does/not/exist": "info string loadhash: open /does/not/exist",
+	} {
+		s.send(cmd, "isready")
+		if _, lines := s.expect("readyok"); !hasPrefix(lines, want) {
+			t.Errorf("%s: replied %q, want %q", cmd, lines, want)
+		}
+	}
+}
+
+func TestBook(t *testing.T) {
+	s := newSession(t)
+	for cmd, want := range map[string]string{
+		"setoption bookmode worst":            "info string bookmode does not accept",
+		"setoption bookfiles /does/not/exist": "info string open /does/not/exist",
+	} {
+		s.send(cmd, "isready")
+		if _, lines := s.expect("readyok"); !hasPrefix(lines, want) {
+			t.Errorf("%s: replied %q, want %q", cmd, lines, want)
+		}
+	}
+
+	// The heaviest legal move of the book is played without a search.
+	s.send("setoption bookfiles ../engine/testdata/small.book", "setoption bookmode best", "position startpos", "go depth 20")
+	if m := s.bestMove(); m != "h2e2" {
+		t.Errorf("book move %s, want h2e2", m)
+	}
+	s.send("setoption bookfiles <empty>", "go depth 1")
+	s.bestMove()
+}
+
+func TestEval(t *testing.T) {
+	s := newSession(t)
+	s.send("position startpos moves h2e2", "eval")
+	line, lines := s.expect("info string Evaluation ")
+	var pos engine.PositionNG
+	if err := pos.Set(engine.StartFEN); err != nil {
+		t.Fatal(err)
+	}
+	m, err := engine.ParseUCIMove(&pos, "h2e2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var st engine.StateInfo
+	pos.DoMove(m, &st)
+	want := "info string Evaluation " + strconv.Itoa(int(pos.Evaluate())) + " for the side to move"
+	if !hasPrefix(lines, "info string     Material |") || !hasPrefix(lines, "info string Phase ") || line != want {
+		t.Errorf("eval replied %q then %q, want %q", lines, line, want)
+	}
+}
+
+func TestSaveEval(t *testing.T) {
+	weights := filepath.Join(t.TempDir(), "weights.json")
+	s := newSession(t)
+	s.send("saveeval "+weights, "saveeval", "isready")
+	if _, lines := s.expect("readyok"); len(lines) != 1 || lines[0] != "info string usage: saveeval <file>" {
+		t.Errorf("saveeval replied %q", lines)
+	}
+	if _, err := os.Stat(weights); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEvalFileChangesEval(t *testing.T) {
+	t.Cleanup(func() {
+		if err := engine.SetEvalParams(engine.DefaultEvalParams()); err != nil {
+			t.Fatal(err)
+		}
+	})
+	weights := filepath.Join(t.TempDir(), "weights.json")
+	if err := os.WriteFile(weights, []byte(`{"phase": {"rook": 12}, "tempo": 20}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := newSession(t)
+	eval := func() []string {
+		s.send("eval")
+		_, lines := s.expect("info string Evaluation ")
+		return lines
+	}
+	s.send("position startpos moves h2e2 h9g7")
+	for _, c := range []struct {
+		setoption    string
+		phase, tempo string
+	}{
+		{"", "info string Phase 56/56", "info string Tempo +3"},
+		{"setoption evalfile " + weights, "info string Phase 80/80", "info string Tempo +20"},
+		{"setoption evalfile <empty>", "info string Phase 56/56", "info string Tempo +3"},
+	} {
+		if c.setoption != "" {
+			s.send(c.setoption)
+		}
+		if lines := eval(); !hasPrefix(lines, c.phase) || !hasPrefix(lines, c.tempo) {
+			t.Errorf("%q: eval replied %q, want %q and %q", c.setoption, lines, c.phase, c.tempo)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package ucci
+
+// dialect selects between the UCCI protocol and the western UCI protocol
+// that many xiangqi GUIs speak. Both share the command loop and the engine
+// calls; they differ in the handshake, option syntax and a few replies.
+type dialect int
+
+const (
+	dialectUCCI dialect = iota
+	dialectUCI
+)
+
+func uciCmd(p *Protocol, args []string) {
+	p.dialect = dialectUCI
+	p.sendLine("id name godogpaw")
+	p.sendLine("id author hmgle")
+	for _, opt := range options {
+		if opt.uciName != "" {
+			p.sendLine("%s", opt.uciString())
+		}
+	}
+	p.sendLine("uciok")
+}
+
+func uciNewGameCmd(p *Protocol, args []string) {
+	p.stopSearch()
+	if err := newGame(p, ""); err != nil {
+		p.sendLine("info string %v", err)
+	}
+}
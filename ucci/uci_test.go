@@ -0,0 +1,45 @@
+package ucci
+
+import "testing"
+
+func TestUCIDialect(t *testing.T) {
+	s := newSession(t)
+	s.send("uci")
+	if _, lines := s.expect("uciok"); !hasPrefix(lines, "option name Hash type spin") || hasPrefix(lines, "option name usemillisec") {
+		t.Errorf("uci reply %q", lines)
+	}
+	for cmd, want := range map[string]string{
+		"setoption name Hash value 0": "info string hashsize out of range",
+		"setoption name Hash":         "info string option hashsize requires a value",
+	} {
+		s.send(cmd, "isready")
+		if _, lines := s.expect("readyok"); !hasPrefix(lines, want) {
+			t.Errorf("%s: replied %q, want %q", cmd, lines, want)
+		}
+	}
+	for _, cmd := range []string{
+		"setoption name Hash value 2",
+		"setoption name Ponder value True",
+		"setoption name Clear Hash",
+		"ucinewgame",
+	} {
+		s.send(cmd, "isready")
+		if _, lines := s.expect("readyok"); len(lines) != 0 {
+			t.Errorf("%s: replied %q", cmd, lines)
+		}
+	}
+
+	// UCI clocks are always in milliseconds.
+	s.send("position startpos moves h2e2", "go wtime 300 btime 300 winc 0 binc 0")
+	s.bestMove()
+	s.send("position fen 3k5/3R5/3R5/9/9/9/9/9/9/4K4 b - - 0 1", "go depth 1")
+	if line, _ := s.expect("bestmove"); line != "bestmove 0000" {
+		t.Errorf("mated side replied %q, want bestmove 0000", line)
+	}
+
+	// UCI has no bye.
+	s.send("quit")
+	if lines := s.rest(); len(lines) != 0 {
+		t.Errorf("uci quit replied %q", lines)
+	}
+}
@@ -4,14 +4,13 @@ package main
 
 import (
 	"encoding/json"
+	"strings"
 	"syscall/js"
 	"time"
 
 	"github.com/hmgle/godogpaw/engine"
 )
 
-const startFEN = "rnbakabnr/9/1c5c1/p1p1p1p1p/9/9/P1P1P1P1P/1C5C1/9/RNBAKABNR w - - 0 1"
-
 var pos engine.PositionNG
 
 type moveRecord struct {
@@ -29,17 +28,20 @@ type boardState struct {
 	IsGameOver bool                  `json:"isGameOver"`
 	LastFrom   int                   `json:"lastMoveFrom"`
 	LastTo     int                   `json:"lastMoveTo"`
+	FEN        string                `json:"fen"`
 }
 
 func engineNewGame(_ js.Value, args []js.Value) any {
-	fen := startFEN
+	fen := engine.StartFEN
 	if len(args) > 0 {
 		s := args[0].String()
 		if s != "" {
 			fen = s
 		}
 	}
-	pos.Set(fen)
+	if err := pos.Set(fen); err != nil {
+		return err.Error()
+	}
 	moveHistory = nil
 	return nil
 }
@@ -50,6 +52,7 @@ func engineGetBoard(_ js.Value, _ []js.Value) any {
 		st.Board[i] = pos.Board[i]
 	}
 	st.SideToMove = int(pos.SideToMove)
+	st.FEN = pos.FEN()
 	st.InCheck = pos.Checkers().IsNotZero()
 
 	// Check game over: no legal moves
@@ -128,6 +131,23 @@ func engineUndoMove(_ js.Value, _ []js.Value) any {
 	return true
 }
 
+// searchMovesArg parses an optional argument listing root moves to search,
+// separated by spaces; illegal moves are skipped.
+func searchMovesArg(args []js.Value, i int) []engine.MoveNG {
+	if len(args) <= i || args[i].Type() != js.TypeString {
+		return nil
+	}
+	var moves []engine.MoveNG
+	for _, s := range strings.Fields(args[i].String()) {
+		if m, err := engine.ParseUCIMove(&pos, s); err == nil {
+			moves = append(moves, m)
+		}
+	}
+	return moves
+}
+
+// engineSearch(depth, timeMs, searchMoves) searches the current position
+// and plays the best move, resolving to it in coordinate notation.
 func engineSearch(_ js.Value, args []js.Value) any {
 	depth := uint8(4)
 	if len(args) > 0 && args[0].Int() > 0 {
@@ -137,12 +157,13 @@ func engineSearch(_ js.Value, args []js.Value) any {
 	if len(args) > 1 && args[1].Int() > 0 {
 		timeLimit = time.Duration(args[1].Int()) * time.Millisecond
 	}
+	searchMoves := searchMovesArg(args, 2)
 
 	// Return a Promise so JS can await the result
 	handler := js.FuncOf(func(_ js.Value, promiseArgs []js.Value) any {
 		resolve := promiseArgs[0]
 		go func() {
-			limits := engine.SearchLimits{Depth: depth, TimeLimit: timeLimit}
+			limits := engine.SearchLimits{Depth: depth, TimeLimit: timeLimit, SearchMoves: searchMoves}
 			bestMove := pos.SearchPositionWithLimits(limits)
 			if !engine.IsOKMove(bestMove) {
 				resolve.Invoke("")
@@ -165,6 +186,54 @@ func engineSearch(_ js.Value, args []js.Value) any {
 	return promiseConstructor.New(handler)
 }
 
+// analysisLine is the JSON form of one engine.PVLine.
+type analysisLine struct {
+	Score int      `json:"score"`
+	Depth int      `json:"depth"`
+	PV    []string `json:"pv"`
+}
+
+// engineAnalyze(depth, timeMs, multiPV, searchMoves) resolves to a JSON array with the
+// best multiPV lines of the current position, best first. Unlike
+// engineSearch it does not play the move.
+func engineAnalyze(_ js.Value, args []js.Value) any {
+	depth := uint8(4)
+	if len(args) > 0 && args[0].Int() > 0 {
+		depth = uint8(args[0].Int())
+	}
+	var timeLimit time.Duration
+	if len(args) > 1 && args[1].Int() > 0 {
+		timeLimit = time.Duration(args[1].Int()) * time.Millisecond
+	}
+	multiPV := 1
+	if len(args) > 2 && args[2].Int() > 0 {
+		multiPV = args[2].Int()
+	}
+	searchMoves := searchMovesArg(args, 3)
+
+	handler := js.FuncOf(func(_ js.Value, promiseArgs []js.Value) any {
+		resolve := promiseArgs[0]
+		go func() {
+			limits := engine.SearchLimits{Depth: depth, TimeLimit: timeLimit, MultiPV: multiPV, SearchMoves: searchMoves}
+			res := engine.DefaultSearcher().Search(&pos, limits)
+			lines := make([]analysisLine, 0, len(res.Lines))
+			for _, l := range res.Lines {
+				line := analysisLine{Score: int(l.Score), Depth: int(l.Depth), PV: []string{}}
+				for _, m := range l.Moves {
+					line.PV = append(line.PV, engine.Move2Str(m))
+				}
+				lines = append(lines, line)
+			}
+			b, _ := json.Marshal(lines)
+			resolve.Invoke(string(b))
+		}()
+		return nil
+	})
+
+	promiseConstructor := js.Global().Get("Promise")
+	return promiseConstructor.New(handler)
+}
+
 func main() {
 	g := js.Global()
 	g.Set("engineNewGame", js.FuncOf(engineNewGame))
@@ -173,9 +242,10 @@ func main() {
 	g.Set("engineDoMoveBySquares", js.FuncOf(engineDoMoveBySquares))
 	g.Set("engineUndoMove", js.FuncOf(engineUndoMove))
 	g.Set("engineSearch", js.FuncOf(engineSearch))
+	g.Set("engineAnalyze", js.FuncOf(engineAnalyze))
 
 	// Initialize with default starting position
-	pos.Set(startFEN)
+	pos.Set(engine.StartFEN)
 
 	// Keep the Go program running
 	select {}
@@ -17,6 +17,7 @@ const REQUIRED_ENGINE_APIS = [
     'engineDoMoveBySquares',
     'engineUndoMove',
     'engineSearch',
+    'engineAnalyze',
 ];
 
 function getMissingEngineApis() {